@@ -2,16 +2,44 @@
 package client
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
+
+	"golang.org/x/net/proxy"
 )
 
 // Option defines an option for a new
 // *http.Client.
 type Option func(c *http.Client) error
 
+// WithHTTPClient receives an *http.Client and returns an
+// Option that uses a copy of it as the base of a new
+// *http.Client, so it can be set up with a custom transport,
+// like a round-tripper that traces the requests. It must be
+// the first Option. An *http.Transport is cloned so the next
+// Options do not modify it, but any other transport is replaced
+// by the Options that configure the transport, like WithProxy.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *http.Client) error {
+		if hc == nil {
+			return nil
+		}
+
+		*c = *hc
+		if tr, ok := c.Transport.(*http.Transport); ok {
+			c.Transport = tr.Clone()
+		}
+		return nil
+	}
+}
+
 // WithTimeout receives a timeout and returns
 // an Option that applies it to a new *http.Client.
 func WithTimeout(t time.Duration) Option {
@@ -23,26 +51,310 @@ func WithTimeout(t time.Duration) Option {
 
 // WithProxy receives a proxy's URL and returns an
 // Option function that parses that URL and, if there is
-// no errors, creates a new http.Transport configured
-// that is applied to a new *http.Client.
-func WithProxy(proxy string) Option {
+// no errors, configures the http.Transport of a new
+// *http.Client to use it. URLs with a socks5 or socks5h
+// scheme are used as SOCKS5 proxies, like Tor's. An empty
+// URL leaves the http.Transport untouched.
+func WithProxy(proxyAddr string) Option {
+	return func(c *http.Client) error {
+		if proxyAddr == "" {
+			return nil
+		}
+
+		proxyURL, err := parseProxy(proxyAddr)
+		if err != nil {
+			return err
+		}
+
+		tr := transport(c)
+		switch proxyURL.Scheme {
+		case "socks5", "socks5h":
+			dialer, err := proxy.FromURL(proxyURL, proxy.Direct)
+			if err != nil {
+				return err
+			}
+
+			cd, ok := dialer.(proxy.ContextDialer)
+			if !ok {
+				return fmt.Errorf("SOCKS5 dialer for %q does not support contexts", proxyAddr)
+			}
+
+			tr.Proxy = nil
+			tr.DialContext = cd.DialContext
+		default:
+			tr.Proxy = http.ProxyURL(proxyURL)
+		}
+
+		return nil
+	}
+}
+
+// parseProxy parses and validates the URL of a proxy.
+func parseProxy(proxyAddr string) (*url.URL, error) {
+	proxyURL, err := url.Parse(proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("proxy URL %q is not valid: %v", proxyAddr, err)
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	case "":
+		return nil, fmt.Errorf("proxy URL %q has no scheme, use http, https, socks5 or socks5h", proxyAddr)
+	default:
+		return nil, fmt.Errorf("scheme %q of proxy URL %q is not supported, use http, https, socks5 or socks5h", proxyURL.Scheme, proxyAddr)
+	}
+
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("proxy URL %q has no host", proxyAddr)
+	}
+
+	if port := proxyURL.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("port %q of proxy URL %q is not valid", port, proxyAddr)
+		}
+	}
+
+	return proxyURL, nil
+}
+
+// WithResolver receives the address of a DNS server, like
+// 1.1.1.1, [2606:4700:4700::1111]:53 or a host, and returns an
+// Option that configures the http.Transport of a new
+// *http.Client to resolve the hosts of the requests with it,
+// on port 53 if addr has none. Both A and AAAA records are
+// used, so IPv6 hosts can be reached. SOCKS5 proxies resolve
+// the hosts themselves, so they must be set after it. An empty
+// address leaves the http.Transport untouched.
+func WithResolver(addr string) Option {
 	return func(c *http.Client) error {
-		if proxy == "" {
-			c.Transport = nil
+		if addr == "" {
 			return nil
 		}
 
-		proxyURL, err := url.Parse(proxy)
+		resolver, err := NewResolver(addr)
 		if err != nil {
 			return err
 		}
 
-		tr := &http.Transport{Proxy: http.ProxyURL(proxyURL)}
-		c.Transport = tr
+		transport(c).DialContext = (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Resolver:  resolver,
+		}).DialContext
+		return nil
+	}
+}
+
+// NewResolver returns a *net.Resolver that sends the queries to
+// the DNS server at addr, on port 53 if it has none.
+func NewResolver(addr string) (*net.Resolver, error) {
+	server, err := resolverAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}, nil
+}
+
+// resolverAddr returns addr with port 53 if it has no port.
+func resolverAddr(addr string) (string, error) {
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		if n, err := strconv.Atoi(port); host == "" || err != nil || n < 1 || n > 65535 {
+			return "", fmt.Errorf("DNS server %q is not valid", addr)
+		}
+		return addr, nil
+	}
+
+	host := strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	if host == "" || strings.ContainsAny(host, "[]/ ") || (strings.Contains(host, ":") && net.ParseIP(host) == nil) {
+		return "", fmt.Errorf("DNS server %q is not valid", addr)
+	}
+
+	return net.JoinHostPort(host, "53"), nil
+}
+
+// WithInsecureSkipVerify receives a boolean and returns an
+// Option that, if it is true, configures the http.Transport
+// of a new *http.Client to not verify TLS certificates.
+func WithInsecureSkipVerify(skip bool) Option {
+	return func(c *http.Client) error {
+		if !skip {
+			return nil
+		}
+
+		tr := transport(c)
+		if tr.TLSClientConfig == nil {
+			tr.TLSClientConfig = &tls.Config{}
+		}
+		tr.TLSClientConfig.InsecureSkipVerify = true
+		return nil
+	}
+}
+
+// WithTLSMinVersion receives a TLS version, like tls.VersionTLS12,
+// and returns an Option that configures the http.Transport of a
+// new *http.Client to not negotiate any older one. A version of 0
+// leaves the default of the crypto/tls package.
+func WithTLSMinVersion(version uint16) Option {
+	return func(c *http.Client) error {
+		if version == 0 {
+			return nil
+		}
+
+		tr := transport(c)
+		if tr.TLSClientConfig == nil {
+			tr.TLSClientConfig = &tls.Config{}
+		}
+		tr.TLSClientConfig.MinVersion = version
+		return nil
+	}
+}
+
+// WithFollowRedirects receives a boolean and returns an
+// Option that, if it is false, makes a new *http.Client
+// return the first response instead of following redirects.
+// If it is true, the redirect policy is left untouched, like
+// the one of the *http.Client received by WithHTTPClient.
+func WithFollowRedirects(follow bool) Option {
+	return func(c *http.Client) error {
+		if follow {
+			return nil
+		}
+
+		c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}
+}
+
+// WithMaxRedirects receives a number of redirects and returns
+// an Option that makes a new *http.Client follow up to n of
+// them and then return the last redirect response, so a site
+// that redirects in a loop is not found instead of failing.
+// Values lower than 1 keep the default of 10 redirects.
+func WithMaxRedirects(n int) Option {
+	return func(c *http.Client) error {
+		if n < 1 {
+			return nil
+		}
+
+		c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) > n {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		}
+		return nil
+	}
+}
+
+// WithDialTimeout receives a timeout and returns an Option
+// that configures the http.Transport of a new *http.Client to
+// wait up to t to establish each connection, through a SOCKS5
+// proxy too, so it must be set after WithResolver and WithProxy.
+// Values lower than 1 leave it untouched.
+func WithDialTimeout(t time.Duration) Option {
+	return func(c *http.Client) error {
+		if t < 1 {
+			return nil
+		}
+
+		tr := transport(c)
+		dial := tr.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{}).DialContext
+		}
+
+		tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			ctx, cancel := context.WithTimeout(ctx, t)
+			defer cancel()
+			return dial(ctx, network, addr)
+		}
+		return nil
+	}
+}
+
+// WithTLSHandshakeTimeout receives a timeout and returns an
+// Option that configures the http.Transport of a new
+// *http.Client to wait up to t for each TLS handshake.
+// Values lower than 1 leave it untouched.
+func WithTLSHandshakeTimeout(t time.Duration) Option {
+	return func(c *http.Client) error {
+		if t < 1 {
+			return nil
+		}
+
+		transport(c).TLSHandshakeTimeout = t
 		return nil
 	}
 }
 
+// WithResponseHeaderTimeout receives a timeout and returns an
+// Option that configures the http.Transport of a new *http.Client
+// to wait up to t for the headers of each response once the
+// request has been written. Values lower than 1 leave it untouched.
+func WithResponseHeaderTimeout(t time.Duration) Option {
+	return func(c *http.Client) error {
+		if t < 1 {
+			return nil
+		}
+
+		transport(c).ResponseHeaderTimeout = t
+		return nil
+	}
+}
+
+// WithMaxIdleConns receives a number of connections and
+// returns an Option that configures the http.Transport of a
+// new *http.Client to keep up to n idle connections in total
+// and per host. Values lower than 1 leave it untouched.
+func WithMaxIdleConns(n int) Option {
+	return func(c *http.Client) error {
+		if n < 1 {
+			return nil
+		}
+
+		tr := transport(c)
+		tr.MaxIdleConns = n
+		tr.MaxIdleConnsPerHost = n
+		return nil
+	}
+}
+
+// WithKeepAlive receives a boolean and returns an Option
+// that, if it is false, configures the http.Transport of a
+// new *http.Client to not reuse connections between requests.
+func WithKeepAlive(keepAlive bool) Option {
+	return func(c *http.Client) error {
+		if keepAlive {
+			return nil
+		}
+
+		transport(c).DisableKeepAlives = true
+		return nil
+	}
+}
+
+// transport returns the *http.Transport of c. If c has
+// no transport yet, it sets a copy of http.DefaultTransport
+// so it can be configured by several Options.
+func transport(c *http.Client) *http.Transport {
+	if tr, ok := c.Transport.(*http.Transport); ok {
+		return tr
+	}
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	c.Transport = tr
+	return tr
+}
+
 // New returns a new *http.Client or an error after applying
 // the received Options.
 func New(opts ...Option) (*http.Client, error) {
@@ -0,0 +1,538 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestNewProxyAndInsecure(t *testing.T) {
+	tt := []struct {
+		name string
+		opts []Option
+	}{
+		{
+			name: "proxy first",
+			opts: []Option{WithProxy("http://localhost:8080"), WithInsecureSkipVerify(true)},
+		},
+		{
+			name: "insecure first",
+			opts: []Option{WithInsecureSkipVerify(true), WithProxy("http://localhost:8080")},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := New(tc.opts...)
+			if err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+
+			tr, ok := c.Transport.(*http.Transport)
+			if !ok {
+				t.Fatalf("expected an *http.Transport. got=%T", c.Transport)
+			}
+
+			if tr.TLSClientConfig == nil || !tr.TLSClientConfig.InsecureSkipVerify {
+				t.Fatalf("expected transport to skip TLS verification")
+			}
+
+			req, _ := http.NewRequest(http.MethodGet, "https://me.com", nil)
+			proxyURL, err := tr.Proxy(req)
+			if err != nil || proxyURL == nil || proxyURL.Host != "localhost:8080" {
+				t.Fatalf("expected transport to use proxy %q. got=%v", "localhost:8080", proxyURL)
+			}
+		})
+	}
+}
+
+func TestNewInvalidProxy(t *testing.T) {
+	tt := []struct {
+		name     string
+		proxy    string
+		expected string
+	}{
+		{
+			name:     "unparsable",
+			proxy:    "http://local host:8080",
+			expected: "is not valid",
+		},
+		{
+			name:     "no scheme",
+			proxy:    "//localhost:8080",
+			expected: "has no scheme",
+		},
+		{
+			name:     "host and port without scheme",
+			proxy:    "localhost:8080",
+			expected: `scheme "localhost" of proxy URL "localhost:8080" is not supported`,
+		},
+		{
+			name:     "unsupported scheme",
+			proxy:    "ftp://localhost:21",
+			expected: `scheme "ftp"`,
+		},
+		{
+			name:     "no host",
+			proxy:    "socks5://",
+			expected: "has no host",
+		},
+		{
+			name:     "invalid port",
+			proxy:    "http://localhost:99999",
+			expected: `port "99999"`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := New(WithProxy(tc.proxy))
+			if err == nil {
+				t.Fatalf("expected to fail")
+			}
+
+			if !strings.Contains(err.Error(), tc.expected) {
+				t.Fatalf("expected error to contain %q. got=%q", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestNewSOCKS5Proxy(t *testing.T) {
+	c, err := New(WithProxy("socks5://127.0.0.1:9050"))
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	tr, ok := c.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("expected an *http.Transport. got=%T", c.Transport)
+	}
+
+	if tr.Proxy != nil {
+		t.Fatalf("expected transport to not use an HTTP proxy")
+	}
+
+	if tr.DialContext == nil {
+		t.Fatalf("expected transport to dial through the SOCKS5 proxy")
+	}
+}
+
+func TestNewConnectionTuning(t *testing.T) {
+	c, err := New(WithMaxIdleConns(0), WithKeepAlive(true))
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	if c.Transport != nil {
+		t.Fatalf("expected the default transport to be left untouched. got=%T", c.Transport)
+	}
+
+	c, err = New(WithMaxIdleConns(50), WithKeepAlive(false))
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	tr, ok := c.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("expected an *http.Transport. got=%T", c.Transport)
+	}
+
+	if tr.MaxIdleConns != 50 || tr.MaxIdleConnsPerHost != 50 {
+		t.Fatalf("expected 50 max idle connections in total and per host. got=%v and %v", tr.MaxIdleConns, tr.MaxIdleConnsPerHost)
+	}
+
+	if !tr.DisableKeepAlives {
+		t.Fatalf("expected transport to disable keep-alives")
+	}
+}
+
+func TestNewPhaseTimeouts(t *testing.T) {
+	c, err := New(WithDialTimeout(0), WithTLSHandshakeTimeout(0), WithResponseHeaderTimeout(0))
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	if c.Transport != nil {
+		t.Fatalf("expected the default transport to be left untouched. got=%T", c.Transport)
+	}
+
+	var deadline bool
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		_, deadline = ctx.Deadline()
+		return nil, errors.New("not dialed")
+	}
+
+	c, err = New(
+		WithHTTPClient(&http.Client{Transport: &http.Transport{DialContext: dial}}),
+		WithDialTimeout(time.Second),
+		WithTLSHandshakeTimeout(2*time.Second),
+		WithResponseHeaderTimeout(3*time.Second),
+	)
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	tr := c.Transport.(*http.Transport)
+	if tr.TLSHandshakeTimeout != 2*time.Second || tr.ResponseHeaderTimeout != 3*time.Second {
+		t.Fatalf("expected TLS handshake and response header timeouts of 2s and 3s. got=%v and %v", tr.TLSHandshakeTimeout, tr.ResponseHeaderTimeout)
+	}
+
+	if _, err := c.Get("http://beagle.test"); err == nil {
+		t.Fatalf("expected to fail with the fake dialer")
+	}
+
+	if !deadline {
+		t.Fatalf("expected the dial to have a deadline")
+	}
+}
+
+func TestNewResponseHeaderTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	c, err := New(WithTimeout(5*time.Second), WithResponseHeaderTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	_, err = c.Get(ts.URL)
+	if err == nil {
+		t.Fatalf("expected to fail waiting for the response headers")
+	}
+
+	if kind := Kind(Classify(err)); kind != "timeout" {
+		t.Fatalf("expected a timeout. got=%q from %v", kind, err)
+	}
+}
+
+func TestNewTLSMinVersion(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	ts.StartTLS()
+	defer ts.Close()
+
+	tt := []struct {
+		name    string
+		version uint16
+		fail    bool
+	}{
+		{name: "default", version: 0},
+		{name: "same version", version: tls.VersionTLS12},
+		{name: "newer version", version: tls.VersionTLS13, fail: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := New(WithTimeout(5*time.Second), WithInsecureSkipVerify(true), WithTLSMinVersion(tc.version))
+			if err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+
+			resp, err := c.Get(ts.URL)
+			if tc.fail {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatalf("expected the handshake to fail with min version %x", tc.version)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+			resp.Body.Close()
+		})
+	}
+}
+
+func TestNewFollowRedirects(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/me", http.StatusFound)
+		}
+	}))
+	defer ts.Close()
+
+	tt := []struct {
+		name     string
+		follow   bool
+		expected int
+	}{
+		{name: "follow", follow: true, expected: http.StatusOK},
+		{name: "do not follow", follow: false, expected: http.StatusFound},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := New(WithFollowRedirects(tc.follow))
+			if err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+
+			resp, err := c.Get(ts.URL)
+			if err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tc.expected {
+				t.Fatalf("expected %v as status code. got=%v", tc.expected, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestNewMaxRedirects(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	}))
+	defer ts.Close()
+
+	tt := []struct {
+		name             string
+		max              int
+		expectedRequests int
+		expectedToFail   bool
+	}{
+		{
+			name:             "default",
+			expectedRequests: 10,
+			expectedToFail:   true,
+		},
+		{
+			name:             "three",
+			max:              3,
+			expectedRequests: 4,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			requests = 0
+			c, err := New(WithMaxRedirects(tc.max))
+			if err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+
+			resp, err := c.Get(ts.URL)
+			if err != nil {
+				if !tc.expectedToFail {
+					t.Fatalf("not expected to fail: %v", err)
+				}
+			} else {
+				resp.Body.Close()
+				if tc.expectedToFail {
+					t.Fatalf("expected to fail")
+				}
+
+				if resp.StatusCode != http.StatusFound {
+					t.Fatalf("expected the last redirect response. got=%v", resp.StatusCode)
+				}
+			}
+
+			if requests != tc.expectedRequests {
+				t.Fatalf("expected %v requests. got=%v", tc.expectedRequests, requests)
+			}
+		})
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	var traced int
+	rt := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		traced++
+		return http.DefaultTransport.RoundTrip(req)
+	})
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	c, err := New(WithHTTPClient(&http.Client{Transport: rt}), WithTimeout(time.Second))
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	resp, err := c.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+	resp.Body.Close()
+
+	if traced != 1 {
+		t.Fatalf("expected the request to go through the custom transport. got=%v requests", traced)
+	}
+
+	if c.Timeout != time.Second {
+		t.Fatalf("expected the next Options to be applied. got=%v as timeout", c.Timeout)
+	}
+
+	base := &http.Client{Transport: &http.Transport{}}
+	c, err = New(WithHTTPClient(base), WithInsecureSkipVerify(true))
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	if cfg := base.Transport.(*http.Transport).TLSClientConfig; cfg != nil && cfg.InsecureSkipVerify {
+		t.Fatalf("expected the transport of the received client to be left untouched")
+	}
+
+	if !c.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify {
+		t.Fatalf("expected the transport of the new client to be configured")
+	}
+}
+
+func TestNewHTTPClientFollowRedirects(t *testing.T) {
+	var checked int
+	custom := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		checked++
+		return http.ErrUseLastResponse
+	}}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/me", http.StatusFound)
+		}
+	}))
+	defer ts.Close()
+
+	c, err := New(WithHTTPClient(custom), WithFollowRedirects(true))
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	resp, err := c.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+	resp.Body.Close()
+
+	if checked != 1 || resp.StatusCode != http.StatusFound {
+		t.Fatalf("expected the redirect policy of the custom client to be kept. got %v calls and status %v", checked, resp.StatusCode)
+	}
+}
+
+func TestResolverAddr(t *testing.T) {
+	tt := []struct {
+		name           string
+		addr           string
+		expected       string
+		expectedToFail bool
+	}{
+		{name: "ipv4", addr: "1.1.1.1", expected: "1.1.1.1:53"},
+		{name: "ipv4 with port", addr: "1.1.1.1:5353", expected: "1.1.1.1:5353"},
+		{name: "ipv6", addr: "2606:4700:4700::1111", expected: "[2606:4700:4700::1111]:53"},
+		{name: "ipv6 with brackets", addr: "[::1]", expected: "[::1]:53"},
+		{name: "ipv6 with port", addr: "[::1]:5353", expected: "[::1]:5353"},
+		{name: "host", addr: "dns.local", expected: "dns.local:53"},
+		{name: "invalid port", addr: "1.1.1.1:dns", expectedToFail: true},
+		{name: "no host", addr: ":53", expectedToFail: true},
+		{name: "invalid", addr: "1.1.1.1:53:53", expectedToFail: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			addr, err := resolverAddr(tc.addr)
+			if err != nil {
+				if !tc.expectedToFail {
+					t.Fatalf("not expected to fail: %v", err)
+				}
+				return
+			}
+
+			if tc.expectedToFail {
+				t.Fatalf("expected to fail")
+			}
+
+			if addr != tc.expected {
+				t.Fatalf("expected %q as address. got=%q", tc.expected, addr)
+			}
+		})
+	}
+}
+
+// serveDNS answers every A query received on conn with 127.0.0.1
+// and every other query with no records until conn is closed.
+func serveDNS(conn net.PacketConn) {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		var p dnsmessage.Parser
+		h, err := p.Start(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		q, err := p.Question()
+		if err != nil {
+			continue
+		}
+
+		b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: h.ID, Response: true, Authoritative: true})
+		b.StartQuestions()
+		b.Question(q)
+		b.StartAnswers()
+		if q.Type == dnsmessage.TypeA {
+			b.AResource(dnsmessage.ResourceHeader{Name: q.Name, Class: q.Class, TTL: 60}, dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}})
+		}
+
+		msg, err := b.Finish()
+		if err != nil {
+			continue
+		}
+		conn.WriteTo(msg, addr)
+	}
+}
+
+func TestNewResolver(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("while listening for DNS queries: %v", err)
+	}
+	defer conn.Close()
+	go serveDNS(conn)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	c, err := New(WithTimeout(5*time.Second), WithResolver(conn.LocalAddr().String()))
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	resp, err := c.Get("http://beagle.test:" + port)
+	if err != nil {
+		t.Fatalf("expected beagle.test to be resolved by the DNS server: %v", err)
+	}
+	resp.Body.Close()
+
+	if _, err := New(WithResolver(":53")); err == nil {
+		t.Fatalf("expected to fail with an invalid DNS server")
+	}
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"syscall"
+)
+
+// Causes of the errors of the requests. Classify wraps the
+// errors so they can be checked with errors.Is.
+var (
+	ErrTimeout = errors.New("timeout")
+	ErrDNS     = errors.New("host not found")
+	ErrRefused = errors.New("connection refused")
+	ErrTLS     = errors.New("TLS error")
+)
+
+// kinds are the causes of the errors along with their short names.
+var kinds = []struct {
+	err  error
+	name string
+}{
+	{ErrTimeout, "timeout"},
+	{ErrDNS, "dns"},
+	{ErrRefused, "refused"},
+	{ErrTLS, "tls"},
+}
+
+// Error is an error of a request with a known cause.
+type Error struct {
+	// Cause is one of ErrTimeout, ErrDNS, ErrRefused or ErrTLS.
+	Cause error
+	// Err is the original error.
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the original error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the cause of e.
+func (e *Error) Is(target error) bool {
+	return target == e.Cause
+}
+
+// Classify returns err wrapped as an *Error if its cause is
+// known, or err as it is otherwise, including nil.
+func Classify(err error) error {
+	if cause := cause(err); cause != nil {
+		return &Error{Cause: cause, Err: err}
+	}
+
+	return err
+}
+
+// Kind returns the short name of the cause of err, like
+// "timeout" or "tls", or an empty string if it is unknown.
+func Kind(err error) string {
+	for _, k := range kinds {
+		if errors.Is(err, k.err) {
+			return k.name
+		}
+	}
+
+	return ""
+}
+
+func cause(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && !dnsErr.IsTimeout {
+		return ErrDNS
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return ErrTimeout
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return ErrRefused
+	}
+
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+		recordHeader     tls.RecordHeaderError
+	)
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid) ||
+		errors.As(err, &recordHeader) {
+		return ErrTLS
+	}
+
+	return nil
+}
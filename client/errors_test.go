@@ -0,0 +1,145 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer slow.Close()
+
+	secure := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	secure.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	secure.StartTLS()
+	defer secure.Close()
+
+	get := func(timeout time.Duration, url string) error {
+		c, err := New(WithTimeout(timeout))
+		if err != nil {
+			return err
+		}
+
+		resp, err := c.Get(url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	tt := []struct {
+		name         string
+		err          error
+		expected     error
+		expectedKind string
+	}{
+		{
+			name:         "timeout",
+			err:          get(10*time.Millisecond, slow.URL),
+			expected:     ErrTimeout,
+			expectedKind: "timeout",
+		},
+		{
+			name:         "connection refused",
+			err:          get(time.Second, "http://127.0.0.1:1"),
+			expected:     ErrRefused,
+			expectedKind: "refused",
+		},
+		{
+			name:         "tls",
+			err:          get(time.Second, secure.URL),
+			expected:     ErrTLS,
+			expectedKind: "tls",
+		},
+		{
+			name:         "dns",
+			err:          fmt.Errorf("while dialing: %w", &net.DNSError{Err: "no such host", Name: "beagle.invalid", IsNotFound: true}),
+			expected:     ErrDNS,
+			expectedKind: "dns",
+		},
+		{
+			name:         "unknown authority",
+			err:          fmt.Errorf("while dialing: %w", x509.UnknownAuthorityError{Cert: &x509.Certificate{}}),
+			expected:     ErrTLS,
+			expectedKind: "tls",
+		},
+		{
+			name:         "hostname",
+			err:          fmt.Errorf("while dialing: %w", x509.HostnameError{Certificate: &x509.Certificate{}, Host: "beagle.invalid"}),
+			expected:     ErrTLS,
+			expectedKind: "tls",
+		},
+		{
+			name:         "invalid certificate",
+			err:          fmt.Errorf("while dialing: %w", x509.CertificateInvalidError{Cert: &x509.Certificate{}, Reason: x509.Expired}),
+			expected:     ErrTLS,
+			expectedKind: "tls",
+		},
+		{
+			name:         "record header",
+			err:          fmt.Errorf("while dialing: %w", tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}),
+			expected:     ErrTLS,
+			expectedKind: "tls",
+		},
+		{
+			name: "tls in the message",
+			err:  errors.New("user not found: tls: is not a valid username"),
+		},
+		{
+			name: "unknown",
+			err:  errors.New("unexpected EOF"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.err == nil {
+				t.Fatalf("expected the request to fail")
+			}
+
+			err := Classify(tc.err)
+			if err.Error() != tc.err.Error() {
+				t.Fatalf("expected the message of the error to be kept. got=%q", err)
+			}
+
+			if kind := Kind(err); kind != tc.expectedKind {
+				t.Fatalf("expected %q as kind. got=%q", tc.expectedKind, kind)
+			}
+
+			var classified *Error
+			if tc.expected == nil {
+				if errors.As(err, &classified) {
+					t.Fatalf("expected error to not be classified. got=%v", classified.Cause)
+				}
+				return
+			}
+
+			if !errors.Is(err, tc.expected) {
+				t.Fatalf("expected error to be %v. got=%v", tc.expected, err)
+			}
+
+			if !errors.As(err, &classified) || classified.Err != tc.err {
+				t.Fatalf("expected error to wrap the original one")
+			}
+
+			if !errors.Is(fmt.Errorf("while checking: %w", err), tc.expected) {
+				t.Fatalf("expected wrapped error to be %v", tc.expected)
+			}
+		})
+	}
+
+	if Classify(nil) != nil {
+		t.Fatalf("expected nil to not be classified")
+	}
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/danielkvist/beagle/scan"
+)
+
+// foundMark is added to the lines of a checkpoint
+// of the sites in which the username was found.
+const foundMark = "\tfound"
+
+// checkpoint records in a file the sites that have been checked
+// so an interrupted search can be resumed without checking
+// them again. Each line of the file identifies one site, and
+// ends with foundMark if the username was found on it.
+type checkpoint struct {
+	f *os.File
+	// done holds the checked sites, and whether
+	// the username was found on them.
+	done map[string]bool
+}
+
+// openCheckpoint loads the sites recorded in the file at path,
+// if it exists, and opens it to record the new ones.
+func openCheckpoint(path string) (*checkpoint, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	done := map[string]bool{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if line := s.Text(); line != "" {
+			key := strings.TrimSuffix(line, foundMark)
+			done[key] = key != line
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("while reading checkpoint: %v", err)
+	}
+
+	return &checkpoint{f: f, done: done}, nil
+}
+
+// checkpointKey returns the line that identifies
+// the site with the received name and mainURL
+// checked for user.
+func checkpointKey(name, mainURL, user string) string {
+	key := strings.Join([]string{name, mainURL, user}, "\t")
+	return strings.NewReplacer("\n", " ", "\r", " ").Replace(key)
+}
+
+// filter returns the sites that have not been checked yet, along
+// with the number of removed ones and how many of them were found.
+func (c *checkpoint) filter(sites []*scan.Site) ([]*scan.Site, int, int) {
+	pending := make([]*scan.Site, 0, len(sites))
+	var found int
+	for _, s := range sites {
+		wasFound, done := c.done[checkpointKey(s.Name, s.MainURL, s.User)]
+		switch {
+		case !done:
+			pending = append(pending, s)
+		case wasFound:
+			found++
+		}
+	}
+
+	return pending, len(sites) - len(pending), found
+}
+
+// record adds the site of r to the checkpoint. Errored and
+// blocked results are not recorded so they are checked again.
+func (c *checkpoint) record(r *scan.Result) error {
+	if r.Error != "" || r.Blocked {
+		return nil
+	}
+
+	line := checkpointKey(r.Name, r.MainURL, r.Username)
+	if r.Found {
+		line += foundMark
+	}
+
+	_, err := fmt.Fprintln(c.f, line)
+	return err
+}
+
+func (c *checkpoint) Close() error {
+	return c.f.Close()
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/danielkvist/beagle/scan"
+)
+
+func TestCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "beagle")
+	if err != nil {
+		t.Fatalf("while creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "checkpoint")
+	sites := []*scan.Site{
+		{Name: "github", MainURL: "https://github.com/me", User: "me"},
+		{Name: "gitlab", MainURL: "https://gitlab.com/me", User: "me"},
+		{Name: "reddit", MainURL: "https://reddit.com/me", User: "me"},
+		{Name: "twitter", MainURL: "https://twitter.com/me", User: "me"},
+		{Name: "gitea", MainURL: "https://gitea.com/me", User: "me"},
+	}
+
+	cp, err := openCheckpoint(path)
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	if pending, removed, _ := cp.filter(sites); len(pending) != len(sites) || removed != 0 {
+		t.Fatalf("expected no site to be checked yet. got=%v removed", removed)
+	}
+
+	results := []*scan.Result{
+		{Name: "github", MainURL: "https://github.com/me", Username: "me", Found: true},
+		{Name: "gitlab", MainURL: "https://gitlab.com/me", Username: "me", Error: "timeout"},
+		{Name: "twitter", MainURL: "https://twitter.com/me", Username: "me", StatusCode: 403, Blocked: true},
+		{Name: "gitea", MainURL: "https://gitea.com/me", Username: "me", StatusCode: 404},
+	}
+	for _, r := range results {
+		if err := cp.record(r); err != nil {
+			t.Fatalf("while recording result: %v", err)
+		}
+	}
+	cp.Close()
+
+	cp, err = openCheckpoint(path)
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+	defer cp.Close()
+
+	pending, removed, found := cp.filter(sites)
+	if removed != 2 || found != 1 {
+		t.Fatalf("expected 2 sites to be already checked and 1 found. got=%v and %v", removed, found)
+	}
+
+	var names []string
+	for _, s := range pending {
+		names = append(names, s.Name)
+	}
+
+	if expected := []string{"gitlab", "reddit", "twitter"}; !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected %q to be pending. got=%q", expected, names)
+	}
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/danielkvist/beagle/client"
+	"github.com/danielkvist/beagle/scan"
+
+	"github.com/spf13/cobra"
+)
+
+// sitesFunc is the name of the bash function that
+// completes the site names of --only and --exclude.
+const sitesFunc = "__beagle_sites"
+
+// bashCompletionFunc defines sitesFunc, which completes the
+// last name of a comma-separated list with the names printed
+// by the hidden sites command for the files of the line.
+const bashCompletionFunc = `__beagle_sites()
+{
+    local args=() i
+    for ((i = 1; i < ${#words[@]} - 1; i++)); do
+        case ${words[i]} in
+            -f|--file|--format|--delimiter|--comment)
+                args+=("${words[i]}" "${words[i+1]}")
+                ;;
+            --file=*|--format=*|--delimiter=*|--comment=*)
+                args+=("${words[i]}")
+                ;;
+        esac
+    done
+
+    local names
+    if names=$("${words[0]}" __sites "${args[@]}" 2>/dev/null); then
+        local last=${cur##*,}
+        COMPREPLY=( $(compgen -P "${cur%"$last"}" -W "${names}" -- "${last}") )
+    fi
+}
+`
+
+// completionCommand returns the command that prints
+// the bash completion script of root.
+func completionCommand(root *cobra.Command) *cobra.Command {
+	return &cobra.Command{
+		Use:   "completion",
+		Short: "Prints the bash completion script",
+		Long: "Completion prints the bash completion script of beagle, which completes the site names of " +
+			"--only and --exclude with the ones of the files set with -f, or ./urls.csv.",
+		Example: "source <(beagle completion)",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return root.GenBashCompletion(os.Stdout)
+		},
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+}
+
+// sitesCommand returns the hidden command that prints the
+// names of the sites of a file, used by the completion script.
+func sitesCommand() *cobra.Command {
+	var (
+		comment   string
+		delimiter string
+		files     []string
+		format    string
+	)
+
+	sites := &cobra.Command{
+		Use:    "__sites",
+		Hidden: true,
+		Args:   cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			parseOpts, err := csvOptions(delimiter, comment)
+			if err != nil {
+				return err
+			}
+
+			c, err := client.New(client.WithTimeout(3 * time.Second))
+			if err != nil {
+				return err
+			}
+
+			parseOpts.users = []string{"beagle"}
+			parseOpts.skipInvalid = true
+			sites, err := readFiles(c, files, format, parseOpts)
+			if err != nil {
+				return err
+			}
+
+			return printSiteNames(os.Stdout, sites)
+		},
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+
+	sites.Flags().StringVar(&comment, "comment", "", "character that starts the comment lines of a .csv file")
+	sites.Flags().StringVar(&delimiter, "delimiter", ",", "character that separates the fields of a .csv file, \\t for tabs")
+	sites.Flags().StringArrayVarP(&files, "file", "f", []string{"./urls.csv"}, ".csv or .json file with the URLs, can be repeated")
+	sites.Flags().StringVar(&format, "format", "", "format of the file with the URLs (csv or json), detected from its extension if empty")
+
+	return sites
+}
+
+// printSiteNames prints the names of sites, sorted
+// and without duplicates, one on each line.
+func printSiteNames(w io.Writer, sites []*scan.Site) error {
+	seen := map[string]bool{}
+	var names []string
+	for _, s := range sites {
+		if seen[s.Name] {
+			continue
+		}
+		seen[s.Name] = true
+		names = append(names, s.Name)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		if _, err := fmt.Fprintln(w, n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danielkvist/beagle/scan"
+)
+
+func TestPrintSiteNames(t *testing.T) {
+	sites := []*scan.Site{
+		{Name: "gitlab", User: "me"},
+		{Name: "github", User: "me"},
+		{Name: "gitlab", User: "myself"},
+	}
+
+	var b strings.Builder
+	if err := printSiteNames(&b, sites); err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	if expected := "github\ngitlab\n"; b.String() != expected {
+		t.Fatalf("expected %q. got=%q", expected, b.String())
+	}
+}
+
+func TestBashCompletion(t *testing.T) {
+	var b strings.Builder
+	if err := Root().GenBashCompletion(&b); err != nil {
+		t.Fatalf("while generating bash completion: %v", err)
+	}
+
+	script := b.String()
+	if !strings.Contains(script, sitesFunc+"()") {
+		t.Fatalf("expected the script to define %s", sitesFunc)
+	}
+
+	for _, flag := range []string{"--only", "--exclude"} {
+		expected := `flags_with_completion+=("` + flag + `")` + "\n" + `    flags_completion+=("` + sitesFunc + `")`
+		if !strings.Contains(script, expected) {
+			t.Fatalf("expected %s to be completed with %s", flag, sitesFunc)
+		}
+	}
+
+	if strings.Contains(script, "_beagle___sites()") {
+		t.Fatalf("expected the hidden sites command to not be completed")
+	}
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// envPrefix is the prefix of the environment
+// variables that set the value of the flags.
+const envPrefix = "BEAGLE_"
+
+// envName returns the name of the environment variable
+// for the flag name, like BEAGLE_MAX_IDLE_CONNS.
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// setFlagsFromEnv sets each flag of fs that has not been set on
+// the command line to the value of its environment variable, if
+// lookup finds it, so the flags take precedence over them.
+func setFlagsFromEnv(fs *pflag.FlagSet, lookup func(string) (string, bool)) error {
+	var err error
+	fs.VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed {
+			return
+		}
+
+		name := envName(f.Name)
+		v, ok := lookup(name)
+		if !ok {
+			return
+		}
+
+		if setErr := fs.Set(f.Name, v); setErr != nil {
+			err = fmt.Errorf("while setting flag --%s from %s: %v", f.Name, name, setErr)
+		}
+	})
+
+	return err
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+func TestSetFlagsFromEnv(t *testing.T) {
+	env := map[string]string{
+		"BEAGLE_USER":           "me,myself",
+		"BEAGLE_GOROUTINES":     "10",
+		"BEAGLE_PROXY":          "socks5://localhost:9050",
+		"BEAGLE_MAX_IDLE_CONNS": "20",
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	var (
+		users      []string
+		goroutines int
+		proxy      string
+		maxIdle    int
+		timeout    time.Duration
+	)
+
+	fs := pflag.NewFlagSet("beagle", pflag.ContinueOnError)
+	fs.StringSliceVar(&users, "user", []string{"me"}, "")
+	fs.IntVar(&goroutines, "goroutines", 1, "")
+	fs.StringVar(&proxy, "proxy", "", "")
+	fs.IntVar(&maxIdle, "max-idle-conns", 0, "")
+	fs.DurationVar(&timeout, "timeout", 3*time.Second, "")
+
+	if err := fs.Parse([]string{"--goroutines", "5"}); err != nil {
+		t.Fatalf("while parsing flags: %v", err)
+	}
+
+	if err := setFlagsFromEnv(fs, lookup); err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	if len(users) != 2 || users[0] != "me" || users[1] != "myself" {
+		t.Fatalf("expected users to be set from the environment. got=%v", users)
+	}
+
+	if goroutines != 5 {
+		t.Fatalf("expected the flag to take precedence over the environment. got=%v goroutines", goroutines)
+	}
+
+	if proxy != "socks5://localhost:9050" || maxIdle != 20 {
+		t.Fatalf("expected proxy and max idle conns to be set from the environment. got=%q and %v", proxy, maxIdle)
+	}
+
+	if timeout != 3*time.Second {
+		t.Fatalf("expected timeout to keep its default. got=%v", timeout)
+	}
+
+	env["BEAGLE_TIMEOUT"] = "soon"
+	if err := setFlagsFromEnv(fs, lookup); err == nil {
+		t.Fatalf("expected to fail with an invalid value")
+	}
+}
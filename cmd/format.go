@@ -0,0 +1,420 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/danielkvist/beagle/scan"
+)
+
+// ANSI escape codes used to colorize the prefixes.
+const (
+	colorGreen  = "\033[32m"
+	colorRed    = "\033[31m"
+	colorYellow = "\033[33m"
+	colorReset  = "\033[0m"
+)
+
+// defaultTemplate is the template used to format
+// the results when no other template is set.
+const defaultTemplate = `{{if .Skipped}}{{.Mark}} {{.Prefix}}{{.URL}} SKIPPED (invalid username)` +
+	`{{else if .Error}}{{.Prefix}}{{.URL}}: {{.Error}}` +
+	`{{else if .Blocked}}{{.Mark}} {{.Prefix}}{{.URL}} BLOCKED ({{.Status}}){{.Elapsed}}` +
+	`{{else if .Found}}{{.Mark}} {{.Prefix}}{{.URL}}{{.Elapsed}}` +
+	`{{else}}{{.Mark}} {{.Prefix}}{{.URL}} NOT FOUND ({{.Status}}){{.Elapsed}}{{end}}`
+
+// availableTemplate is the template used instead of
+// defaultTemplate with --available, which marks the
+// sites in which the username is not taken.
+const availableTemplate = `{{if .Skipped}}{{.Mark}} {{.Prefix}}{{.URL}} SKIPPED (invalid username)` +
+	`{{else if .Error}}{{.Prefix}}{{.URL}}: {{.Error}}` +
+	`{{else if .Blocked}}{{.Mark}} {{.Prefix}}{{.URL}} BLOCKED ({{.Status}}){{.Elapsed}}` +
+	`{{else if .Available}}{{.Mark}} {{.Prefix}}{{.URL}}{{.Elapsed}}` +
+	`{{else}}{{.Mark}} {{.Prefix}}{{.URL}} TAKEN ({{.Status}}){{.Elapsed}}{{end}}`
+
+var (
+	defaultTmpl   = template.Must(template.New("result").Parse(defaultTemplate))
+	availableTmpl = template.Must(template.New("result").Parse(availableTemplate))
+)
+
+// formatter defines how the results
+// are formatted in text mode.
+type formatter struct {
+	verbose  bool
+	withUser bool
+	color    bool
+	slow     time.Duration
+	// available makes the hits the results in which the
+	// username is available instead of the found ones.
+	available bool
+	// tmpl is the template used to format the results. If
+	// nil, defaultTemplate, or availableTemplate, is used.
+	tmpl *template.Template
+}
+
+// parseTemplate parses text as the template for the results
+// and checks that it can be executed with a result.
+func parseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("result").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &formatter{}
+	if err := tmpl.Execute(ioutil.Discard, f.templateResult(&scan.Result{})); err != nil {
+		return nil, err
+	}
+
+	return tmpl, nil
+}
+
+// templateResult holds the fields of a
+// result that can be used on a template.
+type templateResult struct {
+	Name      string
+	URL       string
+	User      string
+	Status    int
+	Found     bool
+	Available bool
+	Skipped   bool
+	Blocked   bool
+	Error     string
+	ElapsedMS int64
+
+	f *formatter
+	r *scan.Result
+}
+
+func (f *formatter) templateResult(r *scan.Result) templateResult {
+	return templateResult{
+		Name:      r.Name,
+		URL:       r.MainURL,
+		User:      r.Username,
+		Status:    r.StatusCode,
+		Found:     r.Found,
+		Available: available(r),
+		Skipped:   r.Skipped,
+		Blocked:   r.Blocked,
+		Error:     r.Error,
+		ElapsedMS: r.ElapsedMS,
+		f:         f,
+		r:         r,
+	}
+}
+
+// Mark returns "[+]" for the hits, "[?]" for
+// the blocked results and "[-]" for the rest.
+func (t templateResult) Mark() string {
+	if t.f.hit(t.r) {
+		return t.f.prefix("[+]", colorGreen)
+	}
+
+	if t.Blocked {
+		return t.f.prefix("[?]", colorYellow)
+	}
+
+	return t.f.prefix("[-]", colorRed)
+}
+
+// Prefix returns the username followed by ": " when
+// searching for several usernames, or an empty string.
+func (t templateResult) Prefix() string {
+	if !t.f.withUser {
+		return ""
+	}
+
+	return t.User + ": "
+}
+
+// Elapsed returns the time that the site took to respond
+// in verbose mode, or an empty string otherwise.
+func (t templateResult) Elapsed() string {
+	return t.f.elapsed(t.r)
+}
+
+// resultLevel returns the level with which r is printed.
+func resultLevel(r *scan.Result) level {
+	switch {
+	case r.Found:
+		return levelInfo
+	case r.Error != "":
+		return levelDebug
+	default:
+		return levelVerbose
+	}
+}
+
+// available reports whether the username of r is available
+// on its site, that is, whether the site was checked without
+// errors and the username was not found.
+func available(r *scan.Result) bool {
+	return !r.Found && !r.Skipped && !r.Blocked && r.Error == ""
+}
+
+// hit reports whether r is printed as a hit: if it
+// is found or, with available, if it is available.
+func (f *formatter) hit(r *scan.Result) bool {
+	if f.available {
+		return available(r)
+	}
+
+	return r.Found
+}
+
+// level returns the level with which r is printed, which
+// is the one of resultLevel swapping the found and the
+// available results with available.
+func (f *formatter) level(r *scan.Result) level {
+	switch {
+	case f.available && available(r):
+		return levelInfo
+	case f.available && r.Found:
+		return levelVerbose
+	default:
+		return resultLevel(r)
+	}
+}
+
+// hits returns the results of results that are hits.
+func (f *formatter) hits(results []*scan.Result) []*scan.Result {
+	h := []*scan.Result{}
+	for _, r := range results {
+		if f.hit(r) {
+			h = append(h, r)
+		}
+	}
+
+	return h
+}
+
+// text returns the message that is printed for r.
+func (f *formatter) text(r *scan.Result) string {
+	tmpl := f.tmpl
+	switch {
+	case tmpl == nil && f.available:
+		tmpl = availableTmpl
+	case tmpl == nil:
+		tmpl = defaultTmpl
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, f.templateResult(r)); err != nil {
+		return fmt.Sprintf("while executing template: %v", err)
+	}
+
+	return b.String()
+}
+
+// prefix returns p wrapped with color
+// if the formatter uses colors.
+func (f *formatter) prefix(p string, color string) string {
+	if !f.color {
+		return p
+	}
+
+	return color + p + colorReset
+}
+
+// elapsed returns the time that the site of r took to
+// respond in verbose mode, or an empty string otherwise.
+func (f *formatter) elapsed(r *scan.Result) string {
+	if !f.verbose {
+		return ""
+	}
+
+	d := time.Duration(r.ElapsedMS) * time.Millisecond
+	if f.slow > 0 && d > f.slow {
+		return fmt.Sprintf(" (%v SLOW)", d)
+	}
+
+	return fmt.Sprintf(" (%v)", d)
+}
+
+// summary counts the outcomes of a search.
+type summary struct {
+	checked  int
+	found    int
+	notFound int
+	errored  int
+	skipped  int
+	blocked  int
+	// foundEarlier is the number of sites found in an
+	// earlier search resumed from a checkpoint.
+	foundEarlier int
+	// available makes String count the not found
+	// results as available and the found ones as taken.
+	available bool
+}
+
+func summarize(results []*scan.Result) summary {
+	var s summary
+	for _, r := range results {
+		switch {
+		case r.Skipped:
+			s.skipped++
+			continue
+		case r.Error != "":
+			s.errored++
+		case r.Blocked:
+			s.blocked++
+		case r.Found:
+			s.found++
+		default:
+			s.notFound++
+		}
+		s.checked++
+	}
+
+	return s
+}
+
+func (s summary) String() string {
+	msg := fmt.Sprintf("%d sites checked: %d found, %d not found, %d errored", s.checked, s.found, s.notFound, s.errored)
+	if s.available {
+		msg = fmt.Sprintf("%d sites checked: %d available, %d taken, %d errored", s.checked, s.notFound, s.found, s.errored)
+	}
+	if s.blocked > 0 {
+		msg += fmt.Sprintf(", %d blocked", s.blocked)
+	}
+	if s.skipped > 0 {
+		msg += fmt.Sprintf(", %d skipped", s.skipped)
+	}
+	if s.foundEarlier > 0 {
+		msg += fmt.Sprintf(" (and %d found in an earlier search)", s.foundEarlier)
+	}
+
+	return msg
+}
+
+// printGroups prints the hits of results under a FOUND heading,
+// or AVAILABLE with --available, and then the rest under a NOT
+// FOUND, or TAKEN, heading, leaving out the results whose level
+// is greater than lv and the headings without results.
+func printGroups(w io.Writer, results []*scan.Result, f *formatter, lv level) error {
+	var hits, misses []*scan.Result
+	for _, r := range results {
+		switch {
+		case f.hit(r):
+			hits = append(hits, r)
+		case f.level(r) <= lv:
+			misses = append(misses, r)
+		}
+	}
+
+	hitsHeading, missesHeading := "FOUND", "NOT FOUND"
+	if f.available {
+		hitsHeading, missesHeading = "AVAILABLE", "TAKEN"
+	}
+
+	groups := []struct {
+		heading string
+		results []*scan.Result
+	}{
+		{hitsHeading, hits},
+		{missesHeading, misses},
+	}
+
+	sep := ""
+	for _, g := range groups {
+		if len(g.results) == 0 {
+			continue
+		}
+
+		if _, err := fmt.Fprintf(w, "%s%s (%d)\n", sep, g.heading, len(g.results)); err != nil {
+			return err
+		}
+
+		for _, r := range g.results {
+			if _, err := fmt.Fprintln(w, f.text(r)); err != nil {
+				return err
+			}
+		}
+		sep = "\n"
+	}
+
+	return nil
+}
+
+// printByUser prints the usernames of results, sorted, each one
+// followed by the name and URL of the sites in which it was found,
+// including the usernames that were not found anywhere.
+func printByUser(w io.Writer, results []*scan.Result) error {
+	byUser := scan.FoundByUser(results)
+	seen := map[string]bool{}
+	var users []string
+	for _, r := range results {
+		if !seen[r.Username] {
+			seen[r.Username] = true
+			users = append(users, r.Username)
+		}
+	}
+	sort.Strings(users)
+
+	for _, u := range users {
+		if _, err := fmt.Fprintf(w, "%s (%d)\n", u, len(byUser[u])); err != nil {
+			return err
+		}
+
+		for _, r := range byUser[u] {
+			if _, err := fmt.Fprintf(w, "  %s %s\n", r.Name, r.MainURL); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// formatTrace formats t as key=value pairs,
+// with the timings rounded to microseconds.
+func formatTrace(t *scan.Trace) string {
+	s := fmt.Sprintf("trace site=%q user=%q url=%q status=%d dns=%v connect=%v tls=%v first_byte=%v total=%v reused=%v",
+		t.Name, t.User, t.URL, t.StatusCode,
+		t.DNS.Round(time.Microsecond), t.Connect.Round(time.Microsecond), t.TLS.Round(time.Microsecond),
+		t.FirstByte.Round(time.Microsecond), t.Total.Round(time.Microsecond), t.Reused)
+	if t.Err != nil {
+		s += fmt.Sprintf(" error=%q", t.Err.Error())
+	}
+
+	return s
+}
+
+// printSites prints the name, username and userURL of each
+// one of sites separated by tabs, one site per line.
+func printSites(w io.Writer, sites []*scan.Site) error {
+	for _, s := range sites {
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%s\n", s.Name, s.User, s.UserURL); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func printJSON(w io.Writer, results []*scan.Result) error {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return fmt.Errorf("while encoding results as JSON: %v", err)
+	}
+
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// printNDJSON prints r as a JSON object in a single line.
+func printNDJSON(w io.Writer, r *scan.Result) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("while encoding result as JSON: %v", err)
+	}
+
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
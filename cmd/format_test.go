@@ -0,0 +1,371 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielkvist/beagle/scan"
+)
+
+func TestFormatterText(t *testing.T) {
+	tt := []struct {
+		name     string
+		r        *scan.Result
+		f        *formatter
+		expected string
+	}{
+		{
+			name:     "found",
+			r:        &scan.Result{MainURL: "https://me.com", Found: true},
+			f:        &formatter{},
+			expected: "[+] https://me.com",
+		},
+		{
+			name:     "not found",
+			r:        &scan.Result{MainURL: "https://me.com", StatusCode: 404},
+			f:        &formatter{},
+			expected: "[-] https://me.com NOT FOUND (404)",
+		},
+		{
+			name:     "not found verbose",
+			r:        &scan.Result{MainURL: "https://me.com", StatusCode: 403, ElapsedMS: 320},
+			f:        &formatter{verbose: true},
+			expected: "[-] https://me.com NOT FOUND (403) (320ms)",
+		},
+		{
+			name:     "error",
+			r:        &scan.Result{MainURL: "https://me.com", Error: "timeout"},
+			f:        &formatter{},
+			expected: "https://me.com: timeout",
+		},
+		{
+			name:     "available",
+			r:        &scan.Result{MainURL: "https://me.com", StatusCode: 404},
+			f:        &formatter{available: true},
+			expected: "[+] https://me.com",
+		},
+		{
+			name:     "taken",
+			r:        &scan.Result{MainURL: "https://me.com", StatusCode: 200, Found: true},
+			f:        &formatter{available: true},
+			expected: "[-] https://me.com TAKEN (200)",
+		},
+		{
+			name:     "error with available",
+			r:        &scan.Result{MainURL: "https://me.com", Error: "timeout"},
+			f:        &formatter{available: true},
+			expected: "https://me.com: timeout",
+		},
+		{
+			name:     "found with user",
+			r:        &scan.Result{MainURL: "https://me.com", Username: "me", Found: true},
+			f:        &formatter{withUser: true},
+			expected: "[+] me: https://me.com",
+		},
+		{
+			name:     "skipped",
+			r:        &scan.Result{MainURL: "https://me.com", Skipped: true},
+			f:        &formatter{},
+			expected: "[-] https://me.com SKIPPED (invalid username)",
+		},
+		{
+			name:     "blocked",
+			r:        &scan.Result{MainURL: "https://me.com", StatusCode: 403, Blocked: true},
+			f:        &formatter{},
+			expected: "[?] https://me.com BLOCKED (403)",
+		},
+		{
+			name:     "found with color",
+			r:        &scan.Result{MainURL: "https://me.com", Found: true},
+			f:        &formatter{color: true},
+			expected: "\033[32m[+]\033[0m https://me.com",
+		},
+		{
+			name:     "not found with color",
+			r:        &scan.Result{MainURL: "https://me.com", StatusCode: 404},
+			f:        &formatter{verbose: true, color: true},
+			expected: "\033[31m[-]\033[0m https://me.com NOT FOUND (404) (0s)",
+		},
+		{
+			name:     "found slow",
+			r:        &scan.Result{MainURL: "https://me.com", Found: true, ElapsedMS: 2000},
+			f:        &formatter{verbose: true, slow: time.Second},
+			expected: "[+] https://me.com (2s SLOW)",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := tc.f.text(tc.r)
+			if msg != tc.expected {
+				t.Fatalf("expected %q as message. got=%q", tc.expected, msg)
+			}
+		})
+	}
+}
+
+func TestFormatterTemplate(t *testing.T) {
+	tt := []struct {
+		name     string
+		template string
+		r        *scan.Result
+		expected string
+		fail     bool
+	}{
+		{
+			name:     "default",
+			template: defaultTemplate,
+			r:        &scan.Result{MainURL: "https://me.com", Found: true},
+			expected: "[+] https://me.com",
+		},
+		{
+			name:     "tsv",
+			template: "{{.Name}}\t{{.URL}}\t{{.Status}}\t{{.Found}}",
+			r:        &scan.Result{Name: "me", MainURL: "https://me.com", StatusCode: 404},
+			expected: "me\thttps://me.com\t404\tfalse",
+		},
+		{
+			name:     "markdown",
+			template: "- [{{.Name}}]({{.URL}}) {{.Mark}}",
+			r:        &scan.Result{Name: "me", MainURL: "https://me.com", Found: true},
+			expected: "- [me](https://me.com) [+]",
+		},
+		{
+			name:     "invalid",
+			template: "{{.Name",
+			fail:     true,
+		},
+		{
+			name:     "unknown field",
+			template: "{{.Site}}",
+			fail:     true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := parseTemplate(tc.template)
+			if tc.fail {
+				if err == nil {
+					t.Fatalf("expected to fail with template %q", tc.template)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+
+			msg := (&formatter{tmpl: tmpl}).text(tc.r)
+			if msg != tc.expected {
+				t.Fatalf("expected %q as message. got=%q", tc.expected, msg)
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	results := []*scan.Result{
+		{Found: true},
+		{Found: true},
+		{},
+		{Error: "timeout"},
+		{Blocked: true},
+		{Skipped: true},
+	}
+
+	s := summarize(results)
+	expected := summary{checked: 5, found: 2, notFound: 1, errored: 1, skipped: 1, blocked: 1}
+	if s != expected {
+		t.Fatalf("expected %+v as summary. got=%+v", expected, s)
+	}
+
+	msg := "5 sites checked: 2 found, 1 not found, 1 errored, 1 blocked, 1 skipped"
+	if s.String() != msg {
+		t.Fatalf("expected %q as message. got=%q", msg, s.String())
+	}
+
+	s.foundEarlier = 3
+	msg = "5 sites checked: 2 found, 1 not found, 1 errored, 1 blocked, 1 skipped (and 3 found in an earlier search)"
+	if s.String() != msg {
+		t.Fatalf("expected %q as message with sites found earlier. got=%q", msg, s.String())
+	}
+
+	s.foundEarlier = 0
+	s.available = true
+	msg = "5 sites checked: 1 available, 2 taken, 1 errored, 1 blocked, 1 skipped"
+	if s.String() != msg {
+		t.Fatalf("expected %q as message with available. got=%q", msg, s.String())
+	}
+}
+
+func TestPrintGroups(t *testing.T) {
+	results := []*scan.Result{
+		{MainURL: "https://github.com/me", Found: true},
+		{MainURL: "https://gitlab.com/me", StatusCode: 404},
+		{MainURL: "https://reddit.com/me", Error: "timeout"},
+		{MainURL: "https://twitter.com/me", Found: true},
+	}
+
+	tt := []struct {
+		name      string
+		results   []*scan.Result
+		lv        level
+		available bool
+		expected  string
+	}{
+		{
+			name:     "info",
+			results:  results,
+			lv:       levelInfo,
+			expected: "FOUND (2)\n[+] https://github.com/me\n[+] https://twitter.com/me\n",
+		},
+		{
+			name:     "verbose",
+			results:  results,
+			lv:       levelVerbose,
+			expected: "FOUND (2)\n[+] https://github.com/me\n[+] https://twitter.com/me\n\nNOT FOUND (1)\n[-] https://gitlab.com/me NOT FOUND (404)\n",
+		},
+		{
+			name:     "debug",
+			results:  results,
+			lv:       levelDebug,
+			expected: "FOUND (2)\n[+] https://github.com/me\n[+] https://twitter.com/me\n\nNOT FOUND (2)\n[-] https://gitlab.com/me NOT FOUND (404)\nhttps://reddit.com/me: timeout\n",
+		},
+		{
+			name:     "nothing found",
+			results:  results[1:3],
+			lv:       levelVerbose,
+			expected: "NOT FOUND (1)\n[-] https://gitlab.com/me NOT FOUND (404)\n",
+		},
+		{
+			name:      "available",
+			results:   results,
+			lv:        levelInfo,
+			available: true,
+			expected:  "AVAILABLE (1)\n[+] https://gitlab.com/me\n",
+		},
+		{
+			name:      "available verbose",
+			results:   results,
+			lv:        levelVerbose,
+			available: true,
+			expected:  "AVAILABLE (1)\n[+] https://gitlab.com/me\n\nTAKEN (2)\n[-] https://github.com/me TAKEN (0)\n[-] https://twitter.com/me TAKEN (0)\n",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := printGroups(&b, tc.results, &formatter{available: tc.available}, tc.lv); err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+
+			if b.String() != tc.expected {
+				t.Fatalf("expected %q. got=%q", tc.expected, b.String())
+			}
+		})
+	}
+}
+
+func TestFormatTrace(t *testing.T) {
+	tt := []struct {
+		name     string
+		trace    *scan.Trace
+		expected string
+	}{
+		{
+			name:     "new connection",
+			trace:    &scan.Trace{Name: "site", User: "me", URL: "https://site.com/me", StatusCode: 200, DNS: 1500 * time.Microsecond, Connect: 2 * time.Millisecond, TLS: 3*time.Millisecond + 400*time.Nanosecond, FirstByte: 10 * time.Millisecond, Total: 11 * time.Millisecond},
+			expected: `trace site="site" user="me" url="https://site.com/me" status=200 dns=1.5ms connect=2ms tls=3ms first_byte=10ms total=11ms reused=false`,
+		},
+		{
+			name:     "reused connection",
+			trace:    &scan.Trace{Name: "site", User: "me", URL: "https://site.com/me", StatusCode: 404, FirstByte: time.Millisecond, Total: time.Millisecond, Reused: true},
+			expected: `trace site="site" user="me" url="https://site.com/me" status=404 dns=0s connect=0s tls=0s first_byte=1ms total=1ms reused=true`,
+		},
+		{
+			name:     "error",
+			trace:    &scan.Trace{Name: "site", User: "me", URL: "https://site.com/me", Total: time.Second, Err: errors.New("connection refused")},
+			expected: `trace site="site" user="me" url="https://site.com/me" status=0 dns=0s connect=0s tls=0s first_byte=0s total=1s reused=false error="connection refused"`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if s := formatTrace(tc.trace); s != tc.expected {
+				t.Fatalf("expected %q. got=%q", tc.expected, s)
+			}
+		})
+	}
+}
+
+func TestPrintByUser(t *testing.T) {
+	results := []*scan.Result{
+		{Name: "twitter", MainURL: "https://twitter.com/myself", Username: "myself", StatusCode: 404},
+		{Name: "github", MainURL: "https://github.com/me", Username: "me", Found: true},
+		{Name: "gitlab", MainURL: "https://gitlab.com/myself", Username: "myself", Error: "timeout"},
+		{Name: "twitter", MainURL: "https://twitter.com/me", Username: "me", Found: true},
+	}
+
+	var b strings.Builder
+	if err := printByUser(&b, results); err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	expected := "me (2)\n  github https://github.com/me\n  twitter https://twitter.com/me\nmyself (0)\n"
+	if b.String() != expected {
+		t.Fatalf("expected %q. got=%q", expected, b.String())
+	}
+}
+
+func TestPrintSites(t *testing.T) {
+	sites := []*scan.Site{
+		{Name: "github", User: "me", UserURL: "https://github.com/me"},
+		{Name: "gitlab", User: "you", UserURL: "https://gitlab.com/you"},
+	}
+
+	var b strings.Builder
+	if err := printSites(&b, sites); err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	expected := "github\tme\thttps://github.com/me\ngitlab\tyou\thttps://gitlab.com/you\n"
+	if b.String() != expected {
+		t.Fatalf("expected %q as output. got=%q", expected, b.String())
+	}
+}
+
+func TestPrintNDJSON(t *testing.T) {
+	var b strings.Builder
+	results := []*scan.Result{
+		{Name: "github", MainURL: "https://github.com/me", Username: "me", StatusCode: 200, Found: true},
+		{Name: "gitlab", MainURL: "https://gitlab.com/me", Username: "me", Error: "timeout"},
+	}
+
+	for _, r := range results {
+		if err := printNDJSON(&b, r); err != nil {
+			t.Fatalf("not expected to fail: %v", err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(lines) != len(results) {
+		t.Fatalf("expected %v lines. got=%v", len(results), len(lines))
+	}
+
+	for i, l := range lines {
+		var r scan.Result
+		if err := json.Unmarshal([]byte(l), &r); err != nil {
+			t.Fatalf("expected line %v to be valid JSON: %v", i, err)
+		}
+
+		if !reflect.DeepEqual(r, *results[i]) {
+			t.Fatalf("expected line %v to be %+v. got=%+v", i, *results[i], r)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danielkvist/beagle/client"
+	"github.com/danielkvist/beagle/scan"
+
+	"github.com/spf13/cobra"
+)
+
+// listedSite is a site as printed by the list command.
+type listedSite struct {
+	Name    string `json:"name"`
+	MainURL string `json:"mainURL"`
+	UserURL string `json:"userURL"`
+}
+
+// listCommand returns the command that prints
+// the sites of a file without checking them.
+func listCommand() *cobra.Command {
+	var (
+		comment   string
+		delimiter string
+		files     []string
+		format    string
+		hasHeader bool
+		output    string
+		urls      bool
+	)
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "Prints the sites of a file without checking them",
+		Long: "List prints the name of every site of a file, and its mainURL and userURL with --urls, " +
+			"without making any request to them, to know the sites that the file covers and write --only filters.",
+		Example: "beagle list -f urls.csv --urls\nbeagle list -f urls.csv -o json",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := setFlagsFromEnv(cmd.Flags(), os.LookupEnv); err != nil {
+				return err
+			}
+
+			if output != "text" && output != "json" {
+				return fmt.Errorf("output format %q is not valid, use text or json", output)
+			}
+
+			parseOpts, err := csvOptions(delimiter, comment)
+			if err != nil {
+				return err
+			}
+
+			// The client is only used to download the
+			// files that are http(s) URLs.
+			c, err := client.New(client.WithTimeout(10 * time.Second))
+			if err != nil {
+				return err
+			}
+
+			// The sites are parsed with the placeholder as
+			// the username, so their URLs are printed as
+			// they are written on the file.
+			parseOpts.users = []string{"$"}
+			parseOpts.hasHeader = hasHeader
+			sites, err := readFiles(c, files, format, parseOpts)
+			if err != nil {
+				return err
+			}
+
+			if output == "json" {
+				return printSiteListJSON(os.Stdout, sites)
+			}
+
+			return printSiteList(os.Stdout, sites, urls)
+		},
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+
+	list.Flags().StringVar(&comment, "comment", "", "character that starts the comment lines of a .csv file")
+	list.Flags().StringVar(&delimiter, "delimiter", ",", "character that separates the fields of a .csv file, \\t for tabs")
+	list.Flags().StringArrayVarP(&files, "file", "f", []string{"./urls.csv"}, ".csv or .json file with the URLs, can be a path, an http(s) URL or - to read it from stdin, can be repeated")
+	list.Flags().StringVar(&format, "format", "", "format of the file with the URLs (csv or json), detected from its extension if empty")
+	list.Flags().BoolVar(&hasHeader, "has-header", false, "skips the first line of the .csv files, which is skipped anyway if it looks like a header")
+	list.Flags().StringVarP(&output, "output", "o", "text", "output format (text or json, which always includes the URLs)")
+	list.Flags().BoolVar(&urls, "urls", false, "prints the mainURL and userURL of the sites too")
+
+	return list
+}
+
+// printSiteList prints the name of each one of sites, in a
+// table with their mainURL and userURL if urls is true.
+func printSiteList(w io.Writer, sites []*scan.Site, urls bool) error {
+	if !urls {
+		for _, s := range sites {
+			if _, err := fmt.Fprintln(w, s.Name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tMAIN URL\tUSER URL")
+	for _, s := range sites {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Name, s.MainURL, s.UserURL)
+	}
+
+	return tw.Flush()
+}
+
+// printSiteListJSON prints sites as a JSON array
+// with the name, mainURL and userURL of each one.
+func printSiteListJSON(w io.Writer, sites []*scan.Site) error {
+	list := make([]listedSite, 0, len(sites))
+	for _, s := range sites {
+		list = append(list, listedSite{Name: s.Name, MainURL: s.MainURL, UserURL: s.UserURL})
+	}
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("while encoding sites as JSON: %v", err)
+	}
+
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
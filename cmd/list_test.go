@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/danielkvist/beagle/scan"
+)
+
+func TestPrintSiteList(t *testing.T) {
+	sites := []*scan.Site{
+		{Name: "github", MainURL: "https://github.com/$", UserURL: "https://github.com/$"},
+		{Name: "gitlab.com", MainURL: "https://gitlab.com/$", UserURL: "https://gitlab.com/api/users?username=$"},
+	}
+
+	tt := []struct {
+		name     string
+		urls     bool
+		expected string
+	}{
+		{name: "names", expected: "github\ngitlab.com\n"},
+		{
+			name: "urls",
+			urls: true,
+			expected: "NAME        MAIN URL              USER URL\n" +
+				"github      https://github.com/$  https://github.com/$\n" +
+				"gitlab.com  https://gitlab.com/$  https://gitlab.com/api/users?username=$\n",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := printSiteList(&b, sites, tc.urls); err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+
+			if b.String() != tc.expected {
+				t.Fatalf("expected %q. got=%q", tc.expected, b.String())
+			}
+		})
+	}
+}
+
+func TestPrintSiteListJSON(t *testing.T) {
+	sites := []*scan.Site{
+		{Name: "github", User: "$", MainURL: "https://github.com/$", UserURL: "https://github.com/$"},
+	}
+
+	var b strings.Builder
+	if err := printSiteListJSON(&b, sites); err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	var list []listedSite
+	if err := json.Unmarshal([]byte(b.String()), &list); err != nil {
+		t.Fatalf("while decoding %q: %v", b.String(), err)
+	}
+
+	expected := []listedSite{{Name: "github", MainURL: "https://github.com/$", UserURL: "https://github.com/$"}}
+	if !reflect.DeepEqual(list, expected) {
+		t.Fatalf("expected %v. got=%v", expected, list)
+	}
+}
+
+func TestListCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "beagle")
+	if err != nil {
+		t.Fatalf("while creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "urls.csv")
+	if err := ioutil.WriteFile(path, []byte("github,https://github.com/$,https://github.com/$\n"), 0644); err != nil {
+		t.Fatalf("while writing %q: %v", path, err)
+	}
+
+	tt := []struct {
+		name     string
+		args     []string
+		expected string
+		fail     bool
+	}{
+		{name: "text", args: []string{"-f", path}, expected: "github\n"},
+		{name: "json", args: []string{"-f", path, "-o", "json"}, expected: "[\n  {\n    \"name\": \"github\",\n    \"mainURL\": \"https://github.com/$\",\n    \"userURL\": \"https://github.com/$\"\n  }\n]\n"},
+		{name: "invalid output", args: []string{"-f", path, "-o", "csv"}, fail: true},
+		{name: "invalid format", args: []string{"-f", path, "--format", "yaml"}, fail: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			list := listCommand()
+			list.SetArgs(tc.args)
+
+			var err error
+			out, _ := captureOutput(t, func() { err = list.Execute() })
+			if (err != nil) != tc.fail {
+				t.Fatalf("expected to fail: %v. got err=%v", tc.fail, err)
+			}
+
+			if out != tc.expected {
+				t.Fatalf("expected %q. got=%q", tc.expected, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+)
+
+// level defines the verbosity of a message.
+type level int
+
+// Levels of the messages. A logger only prints the
+// messages with a level lower or equal than its own.
+const (
+	// levelInfo is used for the messages
+	// that are always printed.
+	levelInfo level = iota
+	// levelVerbose is used for the not found
+	// and skipped sites.
+	levelVerbose
+	// levelDebug is used for the errors.
+	levelDebug
+)
+
+func (l level) String() string {
+	switch l {
+	case levelInfo:
+		return "INFO"
+	case levelVerbose:
+		return "VERBOSE"
+	default:
+		return "DEBUG"
+	}
+}
+
+// logger prints messages with a prefix with their level.
+type logger struct {
+	l     *log.Logger
+	level level
+	// wrap, if not nil, is called with the function
+	// that prints every message instead of calling it,
+	// to print something around the message.
+	wrap func(print func())
+}
+
+func newLogger(w io.Writer, verbose bool, debug bool) *logger {
+	lv := levelInfo
+	switch {
+	case debug:
+		lv = levelDebug
+	case verbose:
+		lv = levelVerbose
+	}
+
+	return &logger{l: log.New(w, "", log.LstdFlags), level: lv}
+}
+
+// enabled reports whether the messages
+// with level lv are printed.
+func (l *logger) enabled(lv level) bool {
+	return l != nil && lv <= l.level
+}
+
+// printf prints a message with level lv if it is enabled.
+func (l *logger) printf(lv level, format string, args ...interface{}) {
+	if !l.enabled(lv) {
+		return
+	}
+
+	print := func() {
+		l.l.Printf("%-7s %s", lv, fmt.Sprintf(format, args...))
+	}
+
+	if l.wrap != nil {
+		l.wrap(print)
+		return
+	}
+
+	print()
+}
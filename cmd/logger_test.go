@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/danielkvist/beagle/scan"
+)
+
+func TestLogger(t *testing.T) {
+	tt := []struct {
+		name     string
+		verbose  bool
+		debug    bool
+		r        *scan.Result
+		expected string
+	}{
+		{
+			name:     "found",
+			r:        &scan.Result{MainURL: "https://me.com", Found: true},
+			expected: "INFO    [+] https://me.com\n",
+		},
+		{
+			name: "not found",
+			r:    &scan.Result{MainURL: "https://me.com"},
+		},
+		{
+			name:     "not found verbose",
+			verbose:  true,
+			r:        &scan.Result{MainURL: "https://me.com", StatusCode: 404},
+			expected: "VERBOSE [-] https://me.com NOT FOUND (404)\n",
+		},
+		{
+			name:    "error verbose",
+			verbose: true,
+			r:       &scan.Result{MainURL: "https://me.com", Error: "timeout"},
+		},
+		{
+			name:     "error debug",
+			debug:    true,
+			r:        &scan.Result{MainURL: "https://me.com", Error: "timeout"},
+			expected: "DEBUG   https://me.com: timeout\n",
+		},
+		{
+			name:     "skipped debug",
+			debug:    true,
+			r:        &scan.Result{MainURL: "https://me.com", Skipped: true},
+			expected: "VERBOSE [-] https://me.com SKIPPED (invalid username)\n",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := newLogger(&buf, tc.verbose, tc.debug)
+			l.l.SetFlags(0)
+
+			l.printf(resultLevel(tc.r), "%s", (&formatter{}).text(tc.r))
+			if buf.String() != tc.expected {
+				t.Fatalf("expected %q as output. got=%q", tc.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestLoggerWrap(t *testing.T) {
+	var buf bytes.Buffer
+	l := newLogger(&buf, false, false)
+	l.l.SetFlags(0)
+	l.wrap = func(print func()) {
+		buf.WriteString("cleared ")
+		print()
+		buf.WriteString("redrawn")
+	}
+
+	l.printf(levelVerbose, "hidden")
+	l.printf(levelInfo, "shown")
+
+	if expected := "cleared INFO    shown\nredrawn"; buf.String() != expected {
+		t.Fatalf("expected wrap to be called only for printed messages %q. got=%q", expected, buf.String())
+	}
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/danielkvist/beagle/scan"
+)
+
+// durationBuckets are the upper bounds in seconds of
+// the buckets of the request duration histogram.
+var durationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metrics counts the results of a search and exposes
+// them in the Prometheus text format.
+type metrics struct {
+	mu       sync.Mutex
+	sites    int
+	outcomes map[string]int
+	// buckets counts the requests whose duration is lower
+	// or equal than each one of durationBuckets.
+	buckets []int
+	count   int
+	sum     float64
+}
+
+func newMetrics(sites int) *metrics {
+	return &metrics{
+		sites:    sites,
+		outcomes: map[string]int{"found": 0, "not_found": 0, "errored": 0, "blocked": 0, "skipped": 0},
+		buckets:  make([]int, len(durationBuckets)),
+	}
+}
+
+// observe adds r to the metrics.
+func (m *metrics) observe(r *scan.Result) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch {
+	case r.Skipped:
+		m.outcomes["skipped"]++
+		return
+	case r.Error != "":
+		m.outcomes["errored"]++
+	case r.Blocked:
+		m.outcomes["blocked"]++
+	case r.Found:
+		m.outcomes["found"]++
+	default:
+		m.outcomes["not_found"]++
+	}
+
+	secs := float64(r.ElapsedMS) / 1000
+	for i, b := range durationBuckets {
+		if secs <= b {
+			m.buckets[i]++
+		}
+	}
+	m.count++
+	m.sum += secs
+}
+
+// write writes the metrics to w in the Prometheus text format.
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP beagle_sites Number of sites of the search.")
+	fmt.Fprintln(w, "# TYPE beagle_sites gauge")
+	fmt.Fprintf(w, "beagle_sites %d\n", m.sites)
+
+	fmt.Fprintln(w, "# HELP beagle_results_total Number of checked sites by outcome.")
+	fmt.Fprintln(w, "# TYPE beagle_results_total counter")
+	for _, o := range []string{"found", "not_found", "errored", "blocked", "skipped"} {
+		fmt.Fprintf(w, "beagle_results_total{outcome=%q} %d\n", o, m.outcomes[o])
+	}
+
+	fmt.Fprintln(w, "# HELP beagle_request_duration_seconds Time that the sites took to respond.")
+	fmt.Fprintln(w, "# TYPE beagle_request_duration_seconds histogram")
+	for i, b := range durationBuckets {
+		fmt.Fprintf(w, "beagle_request_duration_seconds_bucket{le=\"%v\"} %d\n", b, m.buckets[i])
+	}
+	fmt.Fprintf(w, "beagle_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.count)
+	fmt.Fprintf(w, "beagle_request_duration_seconds_sum %v\n", m.sum)
+	fmt.Fprintf(w, "beagle_request_duration_seconds_count %d\n", m.count)
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.write(w)
+}
+
+// serveMetrics starts an HTTP server that exposes m at /metrics
+// on addr and returns a function that shuts it down.
+func serveMetrics(addr string, m *metrics) (func(), error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(ln)
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}, nil
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/danielkvist/beagle/scan"
+)
+
+func TestMetrics(t *testing.T) {
+	m := newMetrics(4)
+	results := []*scan.Result{
+		{Found: true, ElapsedMS: 50},
+		{ElapsedMS: 300},
+		{Error: "timeout", ElapsedMS: 3000},
+		{Skipped: true},
+	}
+	for _, r := range results {
+		m.observe(r)
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	expected := []string{
+		"beagle_sites 4",
+		`beagle_results_total{outcome="found"} 1`,
+		`beagle_results_total{outcome="not_found"} 1`,
+		`beagle_results_total{outcome="errored"} 1`,
+		`beagle_results_total{outcome="skipped"} 1`,
+		`beagle_request_duration_seconds_bucket{le="0.1"} 1`,
+		`beagle_request_duration_seconds_bucket{le="0.5"} 2`,
+		`beagle_request_duration_seconds_bucket{le="5"} 3`,
+		`beagle_request_duration_seconds_bucket{le="+Inf"} 3`,
+		"beagle_request_duration_seconds_sum 3.35",
+		"beagle_request_duration_seconds_count 3",
+	}
+
+	body := rec.Body.String()
+	for _, e := range expected {
+		if !strings.Contains(body, e+"\n") {
+			t.Fatalf("expected metrics to contain %q. got=\n%s", e, body)
+		}
+	}
+}
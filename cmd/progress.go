@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// progress prints on a single line how many
+// sites have been checked out of the total.
+type progress struct {
+	// mu guards the writes to w, which are made from the
+	// goroutine that collects the results and, through
+	// the logger, from the workers.
+	mu       sync.Mutex
+	w        io.Writer
+	total    int
+	checked  int
+	finished bool
+}
+
+func newProgress(w io.Writer, total int) *progress {
+	return &progress{w: w, total: total}
+}
+
+// interrupt erases the progress line, calls print so other
+// messages can be printed in its place and prints the line
+// again below them. Once finished, it only calls print.
+func (p *progress) interrupt(print func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.finished {
+		print()
+		return
+	}
+
+	fmt.Fprint(p.w, "\r\033[K")
+	print()
+	p.print()
+}
+
+// increment marks one more site as checked and
+// prints the progress line again.
+func (p *progress) increment() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.checked++
+	p.print()
+}
+
+func (p *progress) print() {
+	fmt.Fprintf(p.w, "\r[%d/%d] sites checked", p.checked, p.total)
+}
+
+// finish ends the progress line.
+func (p *progress) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.finished = true
+	fmt.Fprintln(p.w)
+}
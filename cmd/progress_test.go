@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	var buf bytes.Buffer
+	p := newProgress(&buf, 2)
+
+	p.increment()
+	p.interrupt(func() { buf.WriteString("message\n") })
+	p.increment()
+	p.finish()
+	p.interrupt(func() { buf.WriteString("summary\n") })
+
+	expected := "\r[1/2] sites checked" +
+		"\r\033[Kmessage\n\r[1/2] sites checked" +
+		"\r[2/2] sites checked\n" +
+		"summary\n"
+	if buf.String() != expected {
+		t.Fatalf("expected %q. got=%q", expected, buf.String())
+	}
+}
+
+func TestProgressConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	p := newProgress(&buf, 100)
+	l := newLogger(&buf, false, false)
+	l.l.SetFlags(0)
+	l.wrap = p.interrupt
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				l.printf(levelInfo, "message %d", i*10+j)
+			}
+		}(i)
+	}
+
+	for i := 0; i < 100; i++ {
+		p.increment()
+	}
+	wg.Wait()
+	p.finish()
+
+	// Every message must be printed whole right after
+	// clearing the line and followed by the progress.
+	for i := 0; i < 100; i++ {
+		msg := fmt.Sprintf("\r\033[KINFO    message %d\n\r[", i)
+		if !strings.Contains(buf.String(), msg) {
+			t.Fatalf("expected message %d to be printed between the progress lines. got=%q", i, buf.String())
+		}
+	}
+}
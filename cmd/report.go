@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/danielkvist/beagle/scan"
+)
+
+var reportTmpl = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Beagle report</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 50em; color: #222; }
+h1 { font-size: 1.6em; }
+h2 { border-bottom: 1px solid #ddd; padding-bottom: .2em; }
+ul { line-height: 1.6; }
+a { color: #0366d6; text-decoration: none; }
+a:hover { text-decoration: underline; }
+.name { display: inline-block; min-width: 10em; font-weight: bold; }
+.empty, summary, footer { color: #666; }
+summary { cursor: pointer; }
+</style>
+</head>
+<body>
+<h1>Beagle report</h1>
+{{range .Users}}
+<h2>{{.Username}}</h2>
+{{if .Found}}<ul>
+{{range .Found}}<li><span class="name">{{.Name}}</span> <a href="{{.MainURL}}">{{.MainURL}}</a></li>
+{{end}}</ul>
+{{else}}<p class="empty">Not found on any site.</p>
+{{end}}{{if .NotFound}}<details>
+<summary>Not found on {{len .NotFound}} sites</summary>
+<ul>
+{{range .NotFound}}<li><span class="name">{{.Name}}</span> {{.MainURL}}{{if .Error}} ({{.Error}}){{else if .Blocked}} (blocked){{end}}</li>
+{{end}}</ul>
+</details>
+{{end}}{{end}}
+<footer>{{.Summary}}. Generated on {{.Date}}.</footer>
+</body>
+</html>
+`))
+
+// saveHTML writes the HTML report of results to the file at path.
+func saveHTML(path string, results []*scan.Result) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := writeHTML(f, results, time.Now()); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// reportUser holds the results of a username in a report.
+type reportUser struct {
+	Username string
+	Found    []*scan.Result
+	NotFound []*scan.Result
+}
+
+// writeHTML writes to w a self-contained HTML page with the
+// results grouped by username. The skipped results are omitted.
+func writeHTML(w io.Writer, results []*scan.Result, now time.Time) error {
+	byUser := map[string]*reportUser{}
+	var users []*reportUser
+	for _, r := range results {
+		if r.Skipped {
+			continue
+		}
+
+		u, ok := byUser[r.Username]
+		if !ok {
+			u = &reportUser{Username: r.Username}
+			byUser[r.Username] = u
+			users = append(users, u)
+		}
+
+		if r.Found {
+			u.Found = append(u.Found, r)
+		} else {
+			u.NotFound = append(u.NotFound, r)
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+
+	return reportTmpl.Execute(w, struct {
+		Users   []*reportUser
+		Summary string
+		Date    string
+	}{
+		Users:   users,
+		Summary: summarize(results).String(),
+		Date:    now.Format("2006-01-02 15:04:05"),
+	})
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielkvist/beagle/scan"
+)
+
+func TestWriteHTML(t *testing.T) {
+	results := []*scan.Result{
+		{Name: "github", MainURL: "https://github.com/you", Username: "you", Found: true},
+		{Name: "gitlab", MainURL: "https://gitlab.com/me", Username: "me", Found: true},
+		{Name: "reddit", MainURL: "https://reddit.com/me", Username: "me", Error: "timeout"},
+		{Name: "evil", MainURL: "https://evil.com/<script>", Username: "me"},
+		{Name: "skipped", MainURL: "https://skipped.com/me", Username: "me", Skipped: true},
+	}
+
+	var b strings.Builder
+	if err := writeHTML(&b, results, time.Date(2019, time.December, 1, 10, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	html := b.String()
+	expected := []string{
+		`<a href="https://gitlab.com/me">https://gitlab.com/me</a>`,
+		`<a href="https://github.com/you">https://github.com/you</a>`,
+		"<summary>Not found on 2 sites</summary>",
+		"https://reddit.com/me (timeout)",
+		"https://evil.com/&lt;script&gt;",
+		"Generated on 2019-12-01 10:00:00",
+	}
+	for _, e := range expected {
+		if !strings.Contains(html, e) {
+			t.Fatalf("expected report to contain %q. got=\n%s", e, html)
+		}
+	}
+
+	if strings.Contains(html, "skipped.com") {
+		t.Fatalf("expected report to omit the skipped sites")
+	}
+
+	if strings.Index(html, "<h2>me</h2>") > strings.Index(html, "<h2>you</h2>") {
+		t.Fatalf("expected usernames to be sorted")
+	}
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danielkvist/beagle/scan"
+)
+
+// resolveGoroutines is the number of hosts
+// that are resolved at the same time.
+const resolveGoroutines = 32
+
+// hostResolver resolves the addresses of a host.
+// It is satisfied by *net.Resolver.
+type hostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// resolveSites resolves concurrently the host of the userURL of
+// each one of sites, once per host, and returns the sites whose
+// host could be resolved along with the ones whose could not. It
+// fails with the error of ctx if it is done before finishing.
+func resolveSites(ctx context.Context, r hostResolver, sites []*scan.Site) ([]*scan.Site, []*scan.Site, error) {
+	var hosts []string
+	seen := map[string]bool{}
+	for _, s := range sites {
+		if h := siteHost(s); h != "" && !seen[h] {
+			seen[h] = true
+			hosts = append(hosts, h)
+		}
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		jobs     = make(chan string)
+		ok       = make(map[string]bool, len(hosts))
+		timedOut bool
+	)
+
+	workers := resolveGoroutines
+	if len(hosts) < workers {
+		workers = len(hosts)
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for h := range jobs {
+				_, err := r.LookupHost(ctx, h)
+				var netErr net.Error
+				mu.Lock()
+				ok[h] = err == nil
+				timedOut = timedOut || (errors.As(err, &netErr) && netErr.Timeout())
+				mu.Unlock()
+			}
+		}()
+	}
+
+dispatch:
+	for _, h := range hosts {
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case jobs <- h:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// The Go resolver sets the deadline of ctx on its connections,
+	// which can time out before ctx is done.
+	if deadline, ok := ctx.Deadline(); ok && timedOut && !time.Now().Before(deadline) {
+		return nil, nil, context.DeadlineExceeded
+	}
+
+	resolved := make([]*scan.Site, 0, len(sites))
+	var unresolved []*scan.Site
+	for _, s := range sites {
+		h := siteHost(s)
+		if h != "" && !ok[h] {
+			unresolved = append(unresolved, s)
+			continue
+		}
+
+		resolved = append(resolved, s)
+	}
+
+	return resolved, unresolved, nil
+}
+
+// siteHost returns the host of the userURL of s without the
+// port, or an empty string if it is not valid or an IP address.
+func siteHost(s *scan.Site) string {
+	u, err := url.Parse(s.UserURL)
+	if err != nil {
+		return ""
+	}
+
+	h := strings.ToLower(u.Hostname())
+	if net.ParseIP(h) != nil {
+		return ""
+	}
+
+	return h
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danielkvist/beagle/scan"
+)
+
+type fakeResolver struct {
+	mu      sync.Mutex
+	hosts   map[string]bool
+	lookups map[string]int
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lookups[host]++
+	if !r.hosts[host] {
+		return nil, fmt.Errorf("no such host %q", host)
+	}
+
+	return []string{"127.0.0.1"}, nil
+}
+
+func TestResolveSites(t *testing.T) {
+	r := &fakeResolver{
+		hosts:   map[string]bool{"github.com": true},
+		lookups: map[string]int{},
+	}
+
+	sites := []*scan.Site{
+		{Name: "github", UserURL: "https://github.com/me"},
+		{Name: "github gist", UserURL: "https://GitHub.com:443/gist/me"},
+		{Name: "dead", UserURL: "https://dead.example/me"},
+		{Name: "local", UserURL: "http://127.0.0.1:8080/me"},
+	}
+
+	resolved, unresolved, err := resolveSites(context.Background(), r, sites)
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	if len(resolved) != 3 {
+		t.Fatalf("expected 3 resolved sites. got=%v", len(resolved))
+	}
+
+	if len(unresolved) != 1 || unresolved[0].Name != "dead" {
+		t.Fatalf("expected only site %q to not be resolved. got=%v", "dead", unresolved)
+	}
+
+	if r.lookups["github.com"] != 1 {
+		t.Fatalf("expected host %q to be resolved once. got=%v", "github.com", r.lookups["github.com"])
+	}
+
+	if r.lookups["127.0.0.1"] != 0 {
+		t.Fatalf("expected IP addresses to not be resolved")
+	}
+}
+
+// pastDeadline is a context whose deadline has passed
+// but that has not been done yet.
+type pastDeadline struct {
+	context.Context
+}
+
+func (pastDeadline) Deadline() (time.Time, bool) {
+	return time.Now().Add(-time.Second), true
+}
+
+type timeoutResolver struct{}
+
+func (timeoutResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return nil, &net.DNSError{Err: "i/o timeout", Name: host, IsTimeout: true}
+}
+
+func TestResolveSitesDone(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tt := []struct {
+		name     string
+		ctx      context.Context
+		resolver hostResolver
+		expected error
+	}{
+		{"canceled", canceled, &fakeResolver{lookups: map[string]int{}}, context.Canceled},
+		{"deadline passed", pastDeadline{context.Background()}, timeoutResolver{}, context.DeadlineExceeded},
+		{"timeout before deadline", context.Background(), timeoutResolver{}, nil},
+	}
+
+	sites := []*scan.Site{{Name: "github", UserURL: "https://github.com/me"}}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := resolveSites(tc.ctx, tc.resolver, sites)
+			if err != tc.expected {
+				t.Fatalf("expected error %v. got=%v", tc.expected, err)
+			}
+		})
+	}
+}
@@ -3,178 +3,913 @@ package cmd
 
 import (
 	"bufio"
-	"encoding/csv"
+	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
-	"log"
-	"net/http"
+	"net"
 	"os"
+	"os/signal"
+	"runtime"
+	"sort"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/danielkvist/beagle/client"
+	"github.com/danielkvist/beagle/scan"
 
 	"github.com/spf13/cobra"
 )
 
-type site struct {
-	name    string
-	mainURL string
-	userURL string
+// Exit codes used by the root command when the
+// search finishes.
+const (
+	ExitFound    = 0
+	ExitNotFound = 1
+	ExitErrored  = 2
+	// ExitFailOn is used when the username is
+	// found with --fail-on found.
+	ExitFailOn = 1
+)
+
+// ExitError is returned by the root command when the search
+// finishes without any error but the process should exit
+// with a non-zero Code.
+type ExitError struct {
+	Code   int
+	Reason string
+}
+
+func (e *ExitError) Error() string {
+	return e.Reason
 }
 
 // Root returns a *cobra.Command.
 func Root() *cobra.Command {
 	var (
-		agent      string
-		debug      bool
-		file       string
-		goroutines int
-		proxy      string
-		timeout    time.Duration
-		user       string
-		verbose    bool
+		agentFile        string
+		agents           []string
+		allowDuplicates  bool
+		allowExec        bool
+		available        bool
+		backoffMode      string
+		basicAuth        string
+		byUser           bool
+		checkMainURL     bool
+		checkpointFile   string
+		comment          string
+		cookies          []string
+		deadline         time.Duration
+		debug            bool
+		delay            time.Duration
+		delimiter        string
+		dialTimeout      time.Duration
+		dns              string
+		domains          []string
+		dryRun           bool
+		exclude          []string
+		failOn           string
+		files            []string
+		first            bool
+		format           string
+		foundCodes       string
+		goroutines       int
+		group            bool
+		hasHeader        bool
+		headerTimeout    time.Duration
+		headerValues     []string
+		htmlReport       string
+		insecure         bool
+		jitter           time.Duration
+		maxBackoff       time.Duration
+		maxBodyBytes     int64
+		maxIdle          int
+		maxPerHost       int
+		maxRedirects     int
+		method           string
+		metricsAddr      string
+		noColor          bool
+		noKeepAlive      bool
+		noRedirect       bool
+		only             []string
+		output           string
+		placeholder      string
+		proxy            string
+		quiet            bool
+		rate             float64
+		requestTimeout   time.Duration
+		retries          int
+		backoff          time.Duration
+		save             string
+		seed             int64
+		shuffle          bool
+		skipInvalid      bool
+		saveFormat       string
+		skipUnresolvable bool
+		slow             time.Duration
+		snippet          int
+		sorted           bool
+		timeout          time.Duration
+		tlsMin           string
+		tlsTimeout       time.Duration
+		tmplText         string
+		trace            bool
+		traceRedirects   bool
+		urlEncode        bool
+		users            []string
+		verbose          bool
+		yes              bool
 	)
 
 	root := &cobra.Command{
 		Use:     "beagle",
 		Short:   "Beagle is a CLI written in Go to search for an specific username across the Internet.",
-		Example: "beagle -g 10 -t 1s -u me -v",
+		Example: "beagle -g 10 -t 1s -u me,myself -v",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			c, err := client.New(client.WithTimeout(timeout), client.WithProxy(proxy))
+			if err := setFlagsFromEnv(cmd.Flags(), os.LookupEnv); err != nil {
+				return err
+			}
+
+			if output != "text" && output != "json" && output != "ndjson" {
+				return fmt.Errorf("output format %q is not valid, use \"text\", \"json\" or \"ndjson\"", output)
+			}
+
+			if byUser && (group || output != "text") {
+				return fmt.Errorf("--by-user can only be used with text output and without --group")
+			}
+
+			if available && byUser {
+				return fmt.Errorf("--available can not be used with --by-user")
+			}
+
+			if saveFormat != "text" && saveFormat != "json" {
+				return fmt.Errorf("save format %q is not valid, use \"text\" or \"json\"", saveFormat)
+			}
+
+			if !validFailOn(failOn) {
+				return fmt.Errorf("fail-on condition %q is not valid, use \"none\", \"errors\", \"not-found\" or \"found\"", failOn)
+			}
+
+			if placeholder == "" {
+				return fmt.Errorf("placeholder can not be empty")
+			}
+
+			if agentFile != "" {
+				f, err := os.Open(agentFile)
+				if err != nil {
+					return fmt.Errorf("while opening user agents file %q: %v", agentFile, err)
+				}
+
+				fileAgents, err := readAgents(f)
+				f.Close()
+				if err != nil {
+					return fmt.Errorf("while reading file %q: %v", agentFile, err)
+				}
+
+				if !cmd.Flags().Changed("agent") {
+					agents = nil
+				}
+				agents = append(agents, fileAgents...)
+			}
+
+			users = cleanUsers(users)
+			if len(users) == 0 {
+				return fmt.Errorf("at least one username is required")
+			}
+
+			globalHeaders, err := parseHeaderValues(headerValues)
 			if err != nil {
-				return fmt.Errorf("while creating a new http.Client: %v", err)
+				return fmt.Errorf("while parsing headers: %v", err)
 			}
 
-			f, err := os.Open(file)
+			globalCookies, err := parseCookies(cookies)
 			if err != nil {
-				return fmt.Errorf("while opening file %q: %v", file, err)
+				return fmt.Errorf("while parsing cookies: %v", err)
 			}
 
-			r := csv.NewReader(bufio.NewReader(f))
-			sites, err := readAndParseCSV(r, user)
+			if available && !cmd.Flags().Changed("template") {
+				tmplText = availableTemplate
+			}
+
+			tmpl, err := parseTemplate(tmplText)
+			if err != nil {
+				return fmt.Errorf("while parsing template: %v", err)
+			}
+
+			credentials, err := parseCredentials(basicAuth)
+			if err != nil {
+				return fmt.Errorf("while parsing basic auth credentials: %v", err)
+			}
+
+			foundStatus, err := parseStatusCodes(foundCodes, ",")
 			if err != nil {
-				return fmt.Errorf("while reading file %q: %v", file, err)
+				return fmt.Errorf("while parsing found status codes: %v", err)
+			}
+
+			tlsVersion, err := parseTLSVersion(tlsMin)
+			if err != nil {
+				return err
+			}
+
+			if noRedirect && maxRedirects > 0 {
+				return fmt.Errorf("--max-redirects can not be used with --no-redirect")
+			}
+
+			if noRedirect && traceRedirects {
+				return fmt.Errorf("--trace-redirects can not be used with --no-redirect")
+			}
+
+			if maxBodyBytes < 0 {
+				return fmt.Errorf("--max-body-bytes can not be negative")
+			}
+
+			if snippet > 0 && !debug {
+				return fmt.Errorf("--snippet can only be used with --debug")
+			}
+
+			c, err := client.New(
+				client.WithTimeout(timeout),
+				client.WithResolver(dns),
+				client.WithProxy(proxy),
+				client.WithDialTimeout(dialTimeout),
+				client.WithTLSHandshakeTimeout(tlsTimeout),
+				client.WithResponseHeaderTimeout(headerTimeout),
+				client.WithFollowRedirects(!noRedirect),
+				client.WithMaxRedirects(maxRedirects),
+				client.WithInsecureSkipVerify(insecure),
+				client.WithTLSMinVersion(tlsVersion),
+				client.WithMaxIdleConns(maxIdle),
+				client.WithKeepAlive(!noKeepAlive),
+			)
+			if err != nil {
+				return err
+			}
+
+			parseOpts, err := csvOptions(delimiter, comment)
+			if err != nil {
+				return err
+			}
+
+			logs := newLogger(os.Stderr, verbose, debug)
+			if !urlEncode {
+				for _, u := range users {
+					if needsEncoding(u) {
+						logs.printf(levelInfo, "username %q has characters that are not valid on URLs, use --url-encode to percent-encode it", u)
+					}
+				}
 			}
 
+			parseOpts.log = logs
+			parseOpts.users = users
+			parseOpts.placeholder = placeholder
+			parseOpts.skipInvalid = skipInvalid
+			parseOpts.urlEncode = urlEncode
+			parseOpts.hasHeader = hasHeader
+			sites, err := readFiles(c, files, format, parseOpts)
+			if err != nil {
+				return err
+			}
+
+			sites = filterSites(sites, only, exclude)
 			if len(sites) == 0 {
-				return fmt.Errorf("csv file %q is empty or is not valid", file)
+				if len(only) > 0 {
+					return fmt.Errorf("no site matches %v", only)
+				}
+				return fmt.Errorf("all the sites have been excluded")
+			}
+
+			if len(domains) > 0 {
+				sites = filterDomains(sites, domains)
+				if len(sites) == 0 {
+					return fmt.Errorf("no site is on the domains %v", domains)
+				}
+			}
+
+			if !allowDuplicates {
+				var removed int
+				sites, removed = dedupe(sites)
+				if removed > 0 {
+					logs.printf(levelVerbose, "%d duplicated sites removed", removed)
+				}
+			}
+
+			var cp *checkpoint
+			var foundEarlier int
+			if checkpointFile != "" {
+				cp, err = openCheckpoint(checkpointFile)
+				if err != nil {
+					return fmt.Errorf("while opening checkpoint %q: %v", checkpointFile, err)
+				}
+				defer cp.Close()
+
+				var removed int
+				sites, removed, foundEarlier = cp.filter(sites)
+				if removed > 0 {
+					logs.printf(levelInfo, "%d sites already checked according to checkpoint %q, %d of them found", removed, checkpointFile, foundEarlier)
+				}
+
+				if len(sites) == 0 {
+					logs.printf(levelInfo, "all the sites have already been checked")
+					return exitError(summary{foundEarlier: foundEarlier}, failOn)
+				}
+			}
+
+			// The deadline and the interrupts stop the
+			// resolution of the hosts of the sites too.
+			ctx, cancel := interruptContext(context.Background())
+			defer cancel()
+
+			if deadline > 0 {
+				ctx, cancel = context.WithTimeout(ctx, deadline)
+				defer cancel()
+			}
+
+			if skipUnresolvable {
+				var unresolved []*scan.Site
+				resolver := net.DefaultResolver
+				if dns != "" {
+					if resolver, err = client.NewResolver(dns); err != nil {
+						return err
+					}
+				}
+
+				sites, unresolved, err = resolveSites(ctx, resolver, sites)
+				if err != nil {
+					return fmt.Errorf("while resolving the hosts of the sites: %v", err)
+				}
+				for _, s := range unresolved {
+					logs.printf(levelVerbose, "skipping site %q: host of %q can not be resolved", s.Name, s.UserURL)
+				}
+
+				if len(unresolved) > 0 {
+					logs.printf(levelInfo, "%d sites skipped because their host can not be resolved", len(unresolved))
+				}
+
+				if len(sites) == 0 {
+					return fmt.Errorf("the host of none of the sites can be resolved")
+				}
+			}
+
+			if shuffle {
+				if seed == 0 {
+					seed = time.Now().UnixNano()
+				}
+				shuffleSites(sites, seed)
+			}
+
+			if dryRun {
+				return printSites(os.Stdout, sites)
 			}
 
-			results := make(chan string, goroutines)
-			sema := make(chan struct{}, goroutines)
-			var wg sync.WaitGroup
+			if !allowExec {
+				for _, s := range sites {
+					if len(s.Detector) > 0 {
+						return fmt.Errorf("site %q has the detector command %q, use --allow-exec to run it", s.Name, strings.Join(s.Detector, " "))
+					}
+				}
+			}
 
-			defer close(results)
-			defer close(sema)
+			if goroutines < 0 {
+				return fmt.Errorf("number of goroutines can not be negative")
+			}
+
+			if goroutines == 0 {
+				goroutines = autoGoroutines(runtime.NumCPU(), len(sites))
+				logs.printf(levelVerbose, "using %d goroutines", goroutines)
+			}
+
+			if n, clamped := clampGoroutines(goroutines, len(sites)); clamped {
+				if !quiet {
+					logs.printf(levelInfo, "%d goroutines requested for %d sites, only %d are used", goroutines, len(sites), n)
+				}
+				goroutines = n
+			}
+
+			if !yes && len(sites) > confirmThreshold && isTerminal(os.Stdin) {
+				ok, err := confirm(os.Stdin, os.Stderr, len(sites), goroutines)
+				if err != nil {
+					return fmt.Errorf("while asking for confirmation: %v", err)
+				}
+
+				if !ok {
+					return fmt.Errorf("search canceled")
+				}
+			}
+
+			var saveFile *os.File
+			if save != "" {
+				saveFile, err = os.Create(save)
+				if err != nil {
+					return fmt.Errorf("while creating file %q: %v", save, err)
+				}
+				defer saveFile.Close()
+			}
+
+			opts := scan.Options{
+				Client:         c,
+				Agents:         agents,
+				Headers:        globalHeaders,
+				Cookies:        globalCookies,
+				BasicAuth:      credentials,
+				Method:         strings.ToUpper(method),
+				FoundStatus:    foundStatus,
+				Goroutines:     goroutines,
+				MaxPerHost:     maxPerHost,
+				Rate:           rate,
+				Retries:        retries,
+				RetryBackoff:   backoff,
+				Backoff:        backoffMode,
+				MaxBackoff:     maxBackoff,
+				RequestTimeout: requestTimeout,
+				TraceRedirects: traceRedirects,
+				Delay:          delay,
+				Jitter:         jitter,
+				MaxBodyBytes:   maxBodyBytes,
+				Snippet:        snippet,
+				CheckMainURL:   checkMainURL,
+				AllowExec:      allowExec,
+			}
+
+			if trace {
+				opts.OnTrace = func(t *scan.Trace) {
+					logs.printf(levelInfo, "%s", formatTrace(t))
+				}
+			}
+
+			results := make(chan *scan.Result, goroutines)
+			done := make(chan struct{})
+			opts.Results = results
+
+			decorate := decorated(quiet, output, isTerminal(os.Stderr))
+			var bar *progress
+			if decorate {
+				bar = newProgress(os.Stderr, len(sites))
+				logs.wrap = bar.interrupt
+			}
+
+			format := &formatter{
+				verbose:   verbose || debug,
+				withUser:  len(users) > 1,
+				color:     !noColor && output == "text" && isTerminal(os.Stdout),
+				slow:      slow,
+				available: available,
+				tmpl:      tmpl,
+			}
+			saveFormatter := &formatter{withUser: len(users) > 1, available: available, tmpl: tmpl}
+
+			var stats *metrics
+			if metricsAddr != "" {
+				stats = newMetrics(len(sites))
+				shutdown, err := serveMetrics(metricsAddr, stats)
+				if err != nil {
+					return fmt.Errorf("while serving metrics on %q: %v", metricsAddr, err)
+				}
+				defer shutdown()
+			}
+
+			var saveErr, outputErr, checkpointErr error
+			emit := func(r *scan.Result) {
+				switch {
+				case output == "text" && group:
+					// Printed by printGroups when the search finishes.
+				case output == "text" && byUser && r.Found:
+					// Printed by printByUser when the search finishes.
+				case output == "text" && format.hit(r):
+					printHit := func() {
+						if outputErr == nil {
+							_, outputErr = fmt.Fprintln(os.Stdout, format.text(r))
+						}
+					}
+
+					if bar != nil {
+						bar.interrupt(printHit)
+					} else {
+						printHit()
+					}
+				case output == "text":
+					logs.printf(format.level(r), "%s", format.text(r))
+				case output == "ndjson" && outputErr == nil:
+					outputErr = printNDJSON(os.Stdout, r)
+				}
+
+				if output == "text" && !group && len(r.Redirects) > 0 {
+					logs.printf(levelVerbose, "%s redirects: %s", r.Name, strings.Join(r.Redirects, " -> "))
+				}
+
+				if output == "text" && !group && r.Snippet != "" {
+					logs.printf(levelDebug, "%s body: %q", r.Name, r.Snippet)
+				}
+
+				if saveFile != nil && saveFormat == "text" && saveFormatter.hit(r) && saveErr == nil {
+					_, saveErr = fmt.Fprintln(saveFile, saveFormatter.text(r))
+				}
+			}
+
+			// With --first, the search is stopped on the first hit and
+			// the results of the requests canceled after it are ignored.
+			ctx, stop := context.WithCancel(ctx)
+			defer stop()
+			var received int
+			var hit bool
 
 			go func() {
-				for msg := range results {
-					log.Println(msg)
+				defer close(done)
+				for r := range results {
+					if hit {
+						continue
+					}
+
+					received++
+					if first && format.hit(r) {
+						hit = true
+						stop()
+					}
+
+					if !sorted && !group {
+						emit(r)
+					}
+
+					if bar != nil {
+						bar.increment()
+					}
+
+					if stats != nil {
+						stats.observe(r)
+					}
+
+					if cp != nil && checkpointErr == nil {
+						checkpointErr = cp.record(r)
+					}
 				}
 			}()
 
-			disclaimer()
-			for _, s := range sites {
-				wg.Add(1)
-				sema <- struct{}{}
+			if decorate {
+				disclaimer()
+			}
+
+			all, searchErr := scan.Search(ctx, sites, opts)
+			close(results)
+			<-done
+
+			if hit {
+				all = all[:received]
+				searchErr = nil
+			}
+
+			if bar != nil {
+				bar.finish()
+			}
+
+			if sorted || group {
+				if sorted {
+					sortResults(all)
+				}
+
+				for _, r := range all {
+					emit(r)
+				}
+			}
+
+			if group && output == "text" && outputErr == nil {
+				outputErr = printGroups(os.Stdout, all, format, logs.level)
+			}
+
+			if byUser && outputErr == nil {
+				outputErr = printByUser(os.Stdout, all)
+			}
+
+			if output == "text" && !quiet {
+				s := summarize(all)
+				s.foundEarlier = foundEarlier
+				s.available = available
+				fmt.Fprintln(os.Stderr, s)
+			}
+
+			if output == "json" && all != nil {
+				outputErr = printJSON(os.Stdout, all)
+			}
 
-				go check(s, c, agent, debug, verbose, results, sema, &wg)
+			if outputErr != nil {
+				return outputErr
 			}
 
-			wg.Wait()
-			return nil
+			if saveFile != nil && saveFormat == "json" && saveErr == nil {
+				saveErr = printJSON(saveFile, saveFormatter.hits(all))
+			}
+
+			if saveErr != nil {
+				return fmt.Errorf("while saving results to %q: %v", save, saveErr)
+			}
+
+			if htmlReport != "" {
+				if err := saveHTML(htmlReport, all); err != nil {
+					return fmt.Errorf("while writing HTML report to %q: %v", htmlReport, err)
+				}
+			}
+
+			if checkpointErr != nil {
+				return fmt.Errorf("while recording checkpoint %q: %v", checkpointFile, checkpointErr)
+			}
+
+			if searchErr != nil {
+				return fmt.Errorf("while searching: %v", searchErr)
+			}
+
+			s := summarize(all)
+			s.foundEarlier = foundEarlier
+			return exitError(s, failOn)
 		},
-		SilenceUsage: true,
+		SilenceErrors: true,
+		SilenceUsage:  true,
 	}
-
-	root.Flags().StringVarP(&agent, "agent", "a", "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:67.0) Gecko/20100101 Firefox/67.0", "user agent")
-	root.Flags().BoolVar(&debug, "debug", false, "prints errors messages")
-	root.Flags().StringVarP(&file, "file", "f", "./urls.csv", ".csv file with the URLs to check")
-	root.Flags().IntVarP(&goroutines, "goroutines", "g", 1, "number of goroutines")
-	root.Flags().StringVarP(&proxy, "proxy", "p", "", "proxy URL")
+	root.AddCommand(validateCommand(), listCommand(), completionCommand(root), sitesCommand())
+	root.BashCompletionFunction = bashCompletionFunc
+
+	root.Flags().StringVar(&agentFile, "agent-file", "", "file with a user agent on each line to rotate between, added to the ones of --agent if it is set")
+	root.Flags().BoolVar(&allowDuplicates, "allow-duplicates", false, "checks the duplicated sites instead of removing them")
+	root.Flags().StringArrayVarP(&agents, "agent", "a", []string{"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:67.0) Gecko/20100101 Firefox/67.0"}, "user agent, can be repeated to rotate between several ones")
+	root.Flags().BoolVar(&allowExec, "allow-exec", false, "allows to run the detector commands of the sites of the file")
+	root.Flags().BoolVar(&available, "available", false, "reports the sites in which the usernames are available, that is, not found, instead of the found ones")
+	root.Flags().StringVar(&backoffMode, "backoff", scan.BackoffExponential, "strategy used to wait between the retries: fixed, exponential or full-jitter, which waits for a random time up to the exponential one")
+	root.Flags().StringVar(&basicAuth, "basic-auth", "", "username:password used to authenticate the requests with HTTP basic auth")
+	root.Flags().BoolVar(&byUser, "by-user", false, "prints each username followed by the sites in which it was found when the search finishes")
+	root.Flags().BoolVar(&checkMainURL, "check-main-url", false, "also requests the mainURL of the sites whose userURL does not find the username and finds it by its status code")
+	root.Flags().StringVar(&checkpointFile, "checkpoint", "", "file in which the checked sites are recorded so a new search with it skips them")
+	root.Flags().StringVar(&comment, "comment", "", "character that starts the comment lines of a .csv file")
+	root.Flags().StringArrayVar(&cookies, "cookie", nil, "cookie with the format name=value added to every request, can be repeated")
+	root.Flags().DurationVar(&deadline, "deadline", 0, "max time to wait for the whole search to finish (0 means no limit)")
+	root.Flags().BoolVar(&debug, "debug", false, "prints errors messages, implies --verbose")
+	root.Flags().DurationVar(&delay, "delay", 0, "time that each goroutine waits before checking a site")
+	root.Flags().StringVar(&delimiter, "delimiter", ",", "character that separates the fields of a .csv file, \\t for tabs")
+	root.Flags().DurationVar(&dialTimeout, "dial-timeout", 0, "max time to establish a connection with a site, within --timeout (0 means no limit of its own)")
+	root.Flags().StringVar(&dns, "dns", "", "address of the DNS server used to resolve the hosts, like 1.1.1.1 or [2606:4700:4700::1111]:53 (not used through SOCKS5 proxies)")
+	root.Flags().StringSliceVar(&domains, "domain-filter", nil, "comma-separated list of domains, like github.com or .uk, the only sites whose mainURL host is one of them or a subdomain are checked")
+	root.Flags().BoolVar(&dryRun, "dry-run", false, "prints the name and the resolved userURL of each site without checking them")
+	root.Flags().StringSliceVar(&exclude, "exclude", nil, "comma-separated list of site names that are not checked")
+	root.Flags().StringVar(&failOn, "fail-on", "", "condition that makes the exit code non-zero: none, errors, not-found or found (by default 1 if not found and 2 if not found with errors)")
+	root.Flags().StringArrayVarP(&files, "file", "f", []string{"./urls.csv"}, ".csv or .json file with the URLs to check, can be a path, an http(s) URL or - to read it from stdin, can be repeated to merge several files")
+	root.Flags().BoolVar(&first, "first", false, "stops the search as soon as a username is found")
+	root.Flags().StringVar(&format, "format", "", "format of the file with the URLs (csv or json), detected from its extension if empty")
+	root.Flags().StringVar(&foundCodes, "found-status", "200", "comma-separated list of status codes that mark a username as found")
+	root.Flags().IntVarP(&goroutines, "goroutines", "g", 1, "number of goroutines, 0 picks one based on the number of CPUs and sites")
+	root.Flags().BoolVar(&group, "group", false, "prints the found results and then the rest under their own headings when the search finishes")
+	root.Flags().BoolVar(&hasHeader, "has-header", false, "skips the first line of the .csv files, which is skipped anyway if it looks like a header")
+	root.Flags().StringArrayVar(&headerValues, "header", nil, "header with the format key:value added to every request, overridden by the headers of each site, can be repeated")
+	root.Flags().StringVar(&htmlReport, "html", "", "file in which an HTML report with the results is written when the search finishes")
+	root.Flags().BoolVar(&insecure, "insecure", false, "does not verify the TLS certificates of the sites")
+	root.Flags().DurationVar(&jitter, "jitter", 0, "max random time added to or subtracted from --delay on each site")
+	root.Flags().DurationVar(&maxBackoff, "max-backoff", 0, "max time to wait between two retries, Retry-After headers included (0 means no limit)")
+	root.Flags().Int64Var(&maxBodyBytes, "max-body-bytes", 1<<20, "max number of bytes of the body of each response that are read to check it (0 means no limit)")
+	root.Flags().IntVar(&maxIdle, "max-idle-conns", 0, "max number of idle connections kept open in total and per host (0 uses the Go defaults)")
+	root.Flags().IntVar(&maxPerHost, "max-per-host", 0, "max number of sites with the same mainURL host checked at the same time (0 means no limit)")
+	root.Flags().IntVar(&maxRedirects, "max-redirects", 0, "max number of redirects followed before the last redirect response is checked, to detect loops (0 uses the Go default of 10)")
+	root.Flags().StringVarP(&method, "method", "m", "GET", "HTTP method used on the requests (GET, HEAD or POST)")
+	root.Flags().StringVar(&metricsAddr, "metrics-addr", "", "address, like :9090, in which Prometheus metrics are served at /metrics during the search")
+	root.Flags().BoolVar(&noColor, "no-color", false, "disables colorized output")
+	root.Flags().BoolVar(&noKeepAlive, "no-keepalive", false, "does not reuse the connections between requests")
+	root.Flags().BoolVar(&noRedirect, "no-redirect", false, "does not follow redirects so the original status code is checked")
+	root.Flags().StringSliceVar(&only, "only", nil, "comma-separated list of the only site names that are checked")
+	root.Flags().StringVarP(&output, "output", "o", "text", "output format (text, json or ndjson to print each result as a JSON line as soon as it is available)")
+	root.Flags().StringVar(&placeholder, "placeholder", "$", "token of the URLs that is replaced by the username")
+	root.Flags().StringVarP(&proxy, "proxy", "p", "", "proxy URL, like http://localhost:8080 or socks5://localhost:9050 for Tor")
+	root.Flags().BoolVarP(&quiet, "quiet", "q", false, "prints only the results, without the banner, the progress and the summary")
+	root.Flags().Float64Var(&rate, "rate", 0, "max number of sites checked per second (0 means no limit)")
+	root.Flags().DurationVar(&requestTimeout, "request-timeout", 0, "max time that the requests to each site can take, retries included, within --timeout and --deadline (0 means no limit of its own)")
+	root.Flags().DurationVar(&headerTimeout, "response-header-timeout", 0, "max time to wait for the headers of a response once the request is sent, within --timeout (0 means no limit of its own)")
+	root.Flags().IntVar(&retries, "retries", 0, "number of times a request is retried after a network error, a 429 or a 5xx response (429s and 503s wait for their Retry-After header, up to --max-backoff)")
+	root.Flags().DurationVar(&backoff, "retry-backoff", 500*time.Millisecond, "time to wait before the first retry, then the next ones depend on --backoff")
+	root.Flags().StringVarP(&save, "save", "s", "", "file in which the found results are saved")
+	root.Flags().StringVar(&saveFormat, "save-format", "text", "format of the saved results (text or json)")
+	root.Flags().Int64Var(&seed, "seed", 0, "seed used by --shuffle to get a reproducible order (0 uses a random one)")
+	root.Flags().BoolVar(&shuffle, "shuffle", false, "checks the sites in a random order")
+	root.Flags().BoolVar(&skipInvalid, "skip-invalid", false, "skips the invalid sites of the file instead of failing")
+	root.Flags().BoolVar(&skipUnresolvable, "skip-unresolvable", false, "resolves the host of each site before the search and skips the ones that can not be resolved")
+	root.Flags().DurationVar(&slow, "slow-threshold", 0, "highlights the sites that take longer than this to respond in verbose mode (0 disables it)")
+	root.Flags().IntVar(&snippet, "snippet", 0, "number of bytes of the body of each response that are printed with --debug (0 disables it)")
+	root.Flags().BoolVar(&sorted, "sorted", false, "prints the results sorted by site name when the search finishes instead of as they arrive")
+	root.Flags().StringVar(&tmplText, "template", defaultTemplate, "Go template used to print each result, with the fields .Name, .URL, .User, .Status, .Found, .Available, .Skipped, .Blocked, .Error and .ElapsedMS")
 	root.Flags().DurationVarP(&timeout, "timeout", "t", 3*time.Second, "max time to wait for a response from a site")
-	root.Flags().StringVarP(&user, "user", "u", "me", "username you want to search for")
+	root.Flags().StringVar(&tlsMin, "tls-min", "", "min TLS version negotiated with the sites: 1.0, 1.1, 1.2 or 1.3 (empty uses the Go default)")
+	root.Flags().DurationVar(&tlsTimeout, "tls-timeout", 0, "max time to wait for the TLS handshake with a site, within --timeout (0 uses the Go default of 10s)")
+	root.Flags().BoolVar(&trace, "trace", false, "prints to stderr the DNS, connect, TLS and first byte timings of every request")
+	root.Flags().BoolVar(&traceRedirects, "trace-redirects", false, "records the redirects followed by the request to each site, printed in verbose mode and included in the JSON output")
+	root.Flags().BoolVar(&urlEncode, "url-encode", false, "percent-encodes the usernames for the part of the URLs in which they are replaced, and as query values on the bodies")
+	root.Flags().StringSliceVarP(&users, "user", "u", []string{"me"}, "usernames you want to search for, comma-separated or repeated")
 	root.Flags().BoolVarP(&verbose, "verbose", "v", false, "prints all the results")
+	root.Flags().BoolVarP(&yes, "yes", "y", false, "does not ask for confirmation before checking a large number of sites")
+
+	root.MarkFlagCustom("only", sitesFunc)
+	root.MarkFlagCustom("exclude", sitesFunc)
 
 	return root
 }
 
-func check(site *site, c *http.Client, agent string, debug bool, verbose bool, out chan<- string, sema <-chan struct{}, wg *sync.WaitGroup) {
-	defer func() {
-		<-sema
-		wg.Done()
-	}()
+// exitError returns an *ExitError for s if the condition failOn
+// is met, or, if it is empty, if no username has been found.
+// Otherwise it returns nil. The sites found in an earlier search
+// resumed from a checkpoint count as found.
+func exitError(s summary, failOn string) error {
+	found := s.found + s.foundEarlier
+	switch failOn {
+	case "none":
+		return nil
+	case "errors":
+		if s.errored > 0 {
+			return &ExitError{Code: ExitErrored, Reason: fmt.Sprintf("%d requests errored", s.errored)}
+		}
+		return nil
+	case "not-found":
+		if found == 0 {
+			return &ExitError{Code: ExitNotFound, Reason: "no username found"}
+		}
+		return nil
+	case "found":
+		if found > 0 {
+			return &ExitError{Code: ExitFailOn, Reason: fmt.Sprintf("username found on %d sites", found)}
+		}
+		return nil
+	}
 
-	statusCode, err := makeRequest(c, site.userURL, agent)
-	if err != nil && debug {
-		out <- err.Error()
-		return
+	switch {
+	case found > 0:
+		return nil
+	case s.errored > 0:
+		return &ExitError{Code: ExitErrored, Reason: fmt.Sprintf("no username found and %d requests errored", s.errored)}
+	default:
+		return &ExitError{Code: ExitNotFound, Reason: "no username found"}
 	}
+}
 
-	if statusCode != http.StatusOK {
-		if verbose {
-			out <- fmt.Sprintf("[-] %s NOT FOUND", site.mainURL)
-		}
-		return
+// validFailOn reports whether failOn is a valid condition for
+// --fail-on. The empty one uses the default exit codes.
+func validFailOn(failOn string) bool {
+	switch failOn {
+	case "", "none", "errors", "not-found", "found":
+		return true
+	default:
+		return false
 	}
+}
 
-	out <- fmt.Sprintf("[+] %s", site.mainURL)
+// parseTLSVersion parses a TLS version like "1.2" into
+// its tls.VersionTLS constant. An empty string returns 0.
+func parseTLSVersion(s string) (uint16, error) {
+	switch strings.TrimSpace(s) {
+	case "":
+		return 0, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("TLS version %q is not valid, use 1.0, 1.1, 1.2 or 1.3", s)
+	}
 }
 
-func disclaimer() {
-	beagle := `	    __
- \,--------/_/'--o  	Use beagle with
- /_    ___    /~"   	responsibility.
-  /_/_/  /_/_/
-^^^^^^^^^^^^^^^^^^
-`
+// readAgents reads the user agents of r, one on each line,
+// ignoring the empty ones. It fails if there is none.
+func readAgents(r io.Reader) ([]string, error) {
+	var agents []string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if agent := strings.TrimSpace(s.Text()); agent != "" {
+			agents = append(agents, agent)
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("while reading user agents: %v", err)
+	}
 
-	fmt.Println(beagle)
+	if len(agents) == 0 {
+		return nil, fmt.Errorf("no user agents found")
+	}
+
+	return agents, nil
 }
 
-func readAndParseCSV(r *csv.Reader, user string) ([]*site, error) {
-	sites := []*site{}
-	for {
-		line, err := r.Read()
-		if err == io.EOF {
-			break
-		}
+// confirmThreshold is the number of sites above which
+// the user is asked for confirmation before searching.
+const confirmThreshold = 1000
 
-		if len(line) != 3 {
-			return nil, fmt.Errorf("line %v has wrong number of fields", line)
-		}
+// confirm asks through w if the search of the received number
+// of sites with the received number of goroutines should
+// continue and reports whether the answer read from r is yes.
+func confirm(r io.Reader, w io.Writer, sites int, goroutines int) (bool, error) {
+	fmt.Fprintf(w, "About to check %d sites with %d goroutines. Continue? [y/N] ", sites, goroutines)
 
-		if err != nil {
-			return nil, err
-		}
+	answer, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// maxAutoGoroutines caps the number
+// of goroutines picked by autoGoroutines.
+const maxAutoGoroutines = 64
+
+// autoGoroutines returns the number of goroutines used when
+// --goroutines is 0. Since checking a site mostly waits on the
+// network it uses 4 goroutines per CPU, but never more than
+// one per site nor more than maxAutoGoroutines.
+func autoGoroutines(cpus int, sites int) int {
+	n := cpus * 4
+	if n > sites {
+		n = sites
+	}
+
+	if n > maxAutoGoroutines {
+		n = maxAutoGoroutines
+	}
 
-		sites = append(sites, &site{
-			name:    line[0],
-			mainURL: replaceURL(line[1], user),
-			userURL: replaceURL(line[2], user),
-		})
+	if n < 1 {
+		n = 1
 	}
 
-	return sites, nil
+	return n
 }
 
-func makeRequest(c *http.Client, url string, agent string) (int, error) {
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return 0, err
+// clampGoroutines returns the number of goroutines that are
+// used for a number of sites, since no more than one per site
+// can check them, and reports if it is lower than goroutines.
+func clampGoroutines(goroutines int, sites int) (int, bool) {
+	if sites < 1 || goroutines <= sites {
+		return goroutines, false
 	}
-	req.Header.Set("User-Agent", agent)
 
-	resp, err := c.Do(req)
+	return sites, true
+}
+
+// sortResults sorts results by site name
+// and then by username, ignoring the case.
+func sortResults(results []*scan.Result) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := strings.ToLower(results[i].Name), strings.ToLower(results[j].Name)
+		if a != b {
+			return a < b
+		}
+
+		return results[i].Username < results[j].Username
+	})
+}
+
+// interruptContext returns a copy of parent that is
+// canceled when the process receives an interrupt signal.
+func interruptContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+
+	go func() {
+		defer signal.Stop(sigs)
+		select {
+		case <-sigs:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// decorated reports whether the banner and the progress are
+// printed to the standard error, which only happens in text
+// mode when it is a terminal.
+func decorated(quiet bool, output string, terminal bool) bool {
+	return !quiet && output == "text" && terminal
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
 	if err != nil {
-		return 0, err
+		return false
 	}
 
-	return resp.StatusCode, nil
+	return fi.Mode()&os.ModeCharDevice != 0
 }
 
-func replaceURL(s, new string) string {
-	return strings.Replace(s, "$", new, 1)
+// disclaimer prints the banner to the standard error so
+// it is not mixed up with the results on the standard output.
+func disclaimer() {
+	beagle := `	    __
+ \,--------/_/'--o  	Use beagle with
+ /_    ___    /~"   	responsibility.
+  /_/_/  /_/_/
+^^^^^^^^^^^^^^^^^^
+`
+
+	fmt.Fprintln(os.Stderr, beagle)
 }
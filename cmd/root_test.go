@@ -1,124 +1,558 @@
 package cmd
 
 import (
-	"encoding/csv"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/danielkvist/beagle/scan"
 )
 
-func TestReadAndParseCSV(t *testing.T) {
-	var fakeCSV []string
-	var i int
-	for ; i <= 1000; i++ {
-		fakeCSV = append(fakeCSV, ".com,https://$.com,https://$.com")
+func TestExitError(t *testing.T) {
+	tt := []struct {
+		name         string
+		s            summary
+		failOn       string
+		expectedCode int
+	}{
+		{
+			name:         "found",
+			s:            summary{found: 1, notFound: 3, errored: 2},
+			expectedCode: ExitFound,
+		},
+		{
+			name:         "not found",
+			s:            summary{notFound: 3},
+			expectedCode: ExitNotFound,
+		},
+		{
+			name:         "errored",
+			s:            summary{notFound: 3, errored: 1},
+			expectedCode: ExitErrored,
+		},
+		{
+			name:         "found in an earlier search",
+			s:            summary{notFound: 3, foundEarlier: 1},
+			expectedCode: ExitFound,
+		},
+		{
+			name:         "fail on found in an earlier search",
+			s:            summary{notFound: 3, foundEarlier: 1},
+			failOn:       "found",
+			expectedCode: ExitFailOn,
+		},
+		{
+			name:         "fail on none",
+			s:            summary{notFound: 3, errored: 1},
+			failOn:       "none",
+			expectedCode: ExitFound,
+		},
+		{
+			name:         "fail on errors with errors",
+			s:            summary{found: 1, errored: 1},
+			failOn:       "errors",
+			expectedCode: ExitErrored,
+		},
+		{
+			name:         "fail on errors without errors",
+			s:            summary{notFound: 3},
+			failOn:       "errors",
+			expectedCode: ExitFound,
+		},
+		{
+			name:         "fail on not found",
+			s:            summary{notFound: 3, errored: 1},
+			failOn:       "not-found",
+			expectedCode: ExitNotFound,
+		},
+		{
+			name:         "fail on found",
+			s:            summary{found: 1, notFound: 3},
+			failOn:       "found",
+			expectedCode: ExitFailOn,
+		},
+		{
+			name:         "fail on found without hits",
+			s:            summary{notFound: 3},
+			failOn:       "found",
+			expectedCode: ExitFound,
+		},
 	}
 
-	r := csv.NewReader(strings.NewReader(strings.Join(fakeCSV, "\n")))
-	sites, err := readAndParseCSV(r, "m")
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := exitError(tc.s, tc.failOn)
+			code := ExitFound
+			if err != nil {
+				code = err.(*ExitError).Code
+			}
+
+			if code != tc.expectedCode {
+				t.Fatalf("expected %v as exit code. got=%v", tc.expectedCode, code)
+			}
+		})
+	}
+}
+
+func TestDecorated(t *testing.T) {
+	tt := []struct {
+		name     string
+		quiet    bool
+		output   string
+		terminal bool
+		expected bool
+	}{
+		{name: "text on a terminal", output: "text", terminal: true, expected: true},
+		{name: "quiet", quiet: true, output: "text", terminal: true},
+		{name: "json", output: "json", terminal: true},
+		{name: "ndjson", output: "ndjson", terminal: true},
+		{name: "not a terminal", output: "text"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := decorated(tc.quiet, tc.output, tc.terminal); got != tc.expected {
+				t.Fatalf("expected decorated to be %v. got=%v", tc.expected, got)
+			}
+		})
+	}
+}
+
+// captureOutput calls f with os.Stdout and os.Stderr
+// replaced by temporary files and returns their content.
+func captureOutput(t *testing.T, f func()) (string, string) {
+	t.Helper()
+
+	stdout, err := ioutil.TempFile("", "stdout")
 	if err != nil {
-		t.Fatalf("while reading and parsing fake .csv: %v", err)
+		t.Fatalf("while creating temporary file: %v", err)
 	}
+	defer os.Remove(stdout.Name())
+	defer stdout.Close()
 
-	if len(sites) != i {
-		t.Fatalf("expected sites to have a length of %v. got=%v", i, len(sites))
+	stderr, err := ioutil.TempFile("", "stderr")
+	if err != nil {
+		t.Fatalf("while creating temporary file: %v", err)
 	}
+	defer os.Remove(stderr.Name())
+	defer stderr.Close()
+
+	oldStdout, oldStderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = stdout, stderr
+	defer func() { os.Stdout, os.Stderr = oldStdout, oldStderr }()
+	f()
+
+	out, _ := ioutil.ReadFile(stdout.Name())
+	errOut, _ := ioutil.ReadFile(stderr.Name())
+	return string(out), string(errOut)
+}
+
+// runRoot runs the root command with args and returns
+// what it prints on the standard output and error.
+func runRoot(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+
+	root := Root()
+	root.SetArgs(args)
+
+	var err error
+	stdout, stderr := captureOutput(t, func() { err = root.Execute() })
+	return stdout, stderr, err
 }
 
-func TestMakeRequest(t *testing.T) {
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
-		switch r.URL.String() {
-		case "/ok":
-			w.WriteHeader(http.StatusOK)
-		case "/notfound":
+// writeSites writes a .csv file in dir with a site for each
+// one of paths of the server at url, named after the path.
+func writeSites(t *testing.T, dir string, url string, paths ...string) string {
+	t.Helper()
+
+	var b strings.Builder
+	for _, p := range paths {
+		fmt.Fprintf(&b, "%s,%s/%s/$,%s/%s/$\n", p, url, p, url, p)
+	}
+
+	path := filepath.Join(dir, "urls.csv")
+	if err := ioutil.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		t.Fatalf("while writing %q: %v", path, err)
+	}
+
+	return path
+}
+
+// sitesServer returns a server that finds the username on the
+// paths that start with /found and not on the rest, counting
+// the requests made to it.
+func sitesServer(requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		if !strings.HasPrefix(r.URL.Path, "/found") {
 			w.WriteHeader(http.StatusNotFound)
-		case "/internalerror":
-			w.WriteHeader(http.StatusInternalServerError)
 		}
 	}))
+}
+
+func TestRootFirst(t *testing.T) {
+	dir, err := ioutil.TempDir("", "beagle")
+	if err != nil {
+		t.Fatalf("while creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tt := []struct {
+		name string
+		args []string
+	}{
+		{name: "json", args: []string{"-o", "json"}},
+		{name: "sorted json", args: []string{"-o", "json", "--sorted"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests int32
+			ts := sitesServer(&requests)
+			defer ts.Close()
+
+			paths := []string{"missing", "found"}
+			for i := 0; i < 50; i++ {
+				paths = append(paths, fmt.Sprintf("missing%d", i))
+			}
+			file := writeSites(t, dir, ts.URL, paths...)
+
+			args := append([]string{"-f", file, "-u", "me", "-g", "1", "--first"}, tc.args...)
+			stdout, _, err := runRoot(t, args...)
+			if err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+
+			var results []*scan.Result
+			if err := json.Unmarshal([]byte(stdout), &results); err != nil {
+				t.Fatalf("while decoding %q: %v", stdout, err)
+			}
+
+			var names []string
+			for _, r := range results {
+				if r == nil {
+					t.Fatalf("expected no nil results. got=%q", stdout)
+				}
+				names = append(names, r.Name)
+			}
+			sort.Strings(names)
+
+			if expected := []string{"found", "missing"}; !reflect.DeepEqual(names, expected) {
+				t.Fatalf("expected only the results received until the first hit %q. got=%q", expected, names)
+			}
+
+			if n := atomic.LoadInt32(&requests); int(n) >= len(paths) {
+				t.Fatalf("expected the search to stop after the first hit. got=%v requests", n)
+			}
+		})
+	}
+}
+
+func TestRootOutputStreams(t *testing.T) {
+	dir, err := ioutil.TempDir("", "beagle")
+	if err != nil {
+		t.Fatalf("while creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var requests int32
+	ts := sitesServer(&requests)
 	defer ts.Close()
 
+	file := filepath.Join(dir, "urls.csv")
+	data := fmt.Sprintf("found,%[1]s/found/$,%[1]s/found/$\nmissing,%[1]s/missing/$,%[1]s/missing/$\ndead,http://127.0.0.1:1/$,http://127.0.0.1:1/$\n", ts.URL)
+	if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatalf("while writing %q: %v", file, err)
+	}
+
+	stdout, stderr, err := runRoot(t, "-f", file, "-u", "me", "--debug", "--sorted")
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(stdout, "\n"), "\n")
+	if expected := "[+] " + ts.URL + "/found/me"; len(lines) != 1 || !strings.HasPrefix(lines[0], expected) {
+		t.Fatalf("expected only the hit on the standard output %q. got=%q", expected, stdout)
+	}
+
+	for _, expected := range []string{
+		ts.URL + "/missing/me NOT FOUND (404)",
+		"http://127.0.0.1:1/me: ",
+		"3 sites checked: 1 found, 1 not found, 1 errored",
+	} {
+		if !strings.Contains(stderr, expected) {
+			t.Fatalf("expected %q on the standard error. got=%q", expected, stderr)
+		}
+	}
+}
+
+func TestRootSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "beagle")
+	if err != nil {
+		t.Fatalf("while creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var requests int32
+	ts := sitesServer(&requests)
+	defer ts.Close()
+
+	file := writeSites(t, dir, ts.URL, "found", "missing")
+	save := filepath.Join(dir, "found.txt")
+
+	t.Run("text", func(t *testing.T) {
+		if _, _, err := runRoot(t, "-f", file, "-u", "me", "-q", "--save", save); err != nil {
+			t.Fatalf("not expected to fail: %v", err)
+		}
+
+		data, err := ioutil.ReadFile(save)
+		if err != nil {
+			t.Fatalf("while reading %q: %v", save, err)
+		}
+
+		if expected := "[+] " + ts.URL + "/found/me\n"; string(data) != expected {
+			t.Fatalf("expected %q to be saved. got=%q", expected, data)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		if _, _, err := runRoot(t, "-f", file, "-u", "me", "-q", "--save", save, "--save-format", "json"); err != nil {
+			t.Fatalf("not expected to fail: %v", err)
+		}
+
+		data, err := ioutil.ReadFile(save)
+		if err != nil {
+			t.Fatalf("while reading %q: %v", save, err)
+		}
+
+		var results []*scan.Result
+		if err := json.Unmarshal(data, &results); err != nil {
+			t.Fatalf("while decoding %q: %v", data, err)
+		}
+
+		if len(results) != 1 || results[0].Name != "found" || !results[0].Found {
+			t.Fatalf("expected only the found result to be saved. got=%q", data)
+		}
+	})
+
+	t.Run("file can not be created", func(t *testing.T) {
+		path := filepath.Join(dir, "missing", "found.txt")
+		before := atomic.LoadInt32(&requests)
+		_, _, err := runRoot(t, "-f", file, "-u", "me", "-q", "--save", path)
+		if err == nil || !strings.Contains(err.Error(), "while creating file") {
+			t.Fatalf("expected to fail creating %q. got err=%v", path, err)
+		}
+
+		if n := atomic.LoadInt32(&requests) - before; n != 0 {
+			t.Fatalf("expected no site to be checked. got=%v requests", n)
+		}
+	})
+}
+
+func TestRootDeadlineStopsResolution(t *testing.T) {
+	dir, err := ioutil.TempDir("", "beagle")
+	if err != nil {
+		t.Fatalf("while creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A DNS server that never answers.
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("while listening: %v", err)
+	}
+	defer conn.Close()
+
+	file := writeSites(t, dir, "http://beagle.test", "github")
+
+	start := time.Now()
+	_, _, err = runRoot(t, "-f", file, "-u", "me", "-q", "--skip-unresolvable", "--dns", conn.LocalAddr().String(), "--deadline", "100ms")
+	if err == nil || !strings.Contains(err.Error(), "while resolving") {
+		t.Fatalf("expected the resolution to be stopped by the deadline. got err=%v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("expected the resolution to stop after the deadline. got=%v", elapsed)
+	}
+}
+
+func TestDisclaimer(t *testing.T) {
+	out, banner := captureOutput(t, disclaimer)
+	if len(out) > 0 {
+		t.Fatalf("expected nothing on the standard output. got=%q", out)
+	}
+
+	if !strings.Contains(banner, "Use beagle with") {
+		t.Fatalf("expected the banner on the standard error. got=%q", banner)
+	}
+}
+
+func TestSortResults(t *testing.T) {
+	results := []*scan.Result{
+		{Name: "twitter", Username: "me"},
+		{Name: "GitHub", Username: "you"},
+		{Name: "github", Username: "me"},
+		{Name: "Reddit", Username: "me"},
+	}
+
+	sortResults(results)
+
+	expected := []string{"github/me", "GitHub/you", "Reddit/me", "twitter/me"}
+	for i, r := range results {
+		if got := r.Name + "/" + r.Username; got != expected[i] {
+			t.Fatalf("expected result %v to be %q. got=%q", i, expected[i], got)
+		}
+	}
+}
+
+func TestAutoGoroutines(t *testing.T) {
 	tt := []struct {
-		name               string
-		url                string
-		expectedToFail     bool
-		expectedStatusCode int
+		name     string
+		cpus     int
+		sites    int
+		expected int
 	}{
-		{
-			name:           "no URL",
-			url:            "",
-			expectedToFail: true,
-		},
-		{
-			name:               "ok",
-			url:                ts.URL + "/ok",
-			expectedToFail:     false,
-			expectedStatusCode: http.StatusOK,
-		},
-		{
-			name:               "404",
-			url:                ts.URL + "/notfound",
-			expectedToFail:     false,
-			expectedStatusCode: http.StatusNotFound,
-		},
-		{
-			name:               "500",
-			url:                ts.URL + "/internalerror",
-			expectedToFail:     false,
-			expectedStatusCode: http.StatusInternalServerError,
-		},
+		{name: "per cpu", cpus: 2, sites: 100, expected: 8},
+		{name: "fewer sites", cpus: 8, sites: 5, expected: 5},
+		{name: "capped", cpus: 32, sites: 500, expected: maxAutoGoroutines},
+		{name: "no sites", cpus: 4, sites: 0, expected: 1},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			n := autoGoroutines(tc.cpus, tc.sites)
+			if n != tc.expected {
+				t.Fatalf("expected %v goroutines. got=%v", tc.expected, n)
+			}
+		})
+	}
+}
+
+func TestClampGoroutines(t *testing.T) {
+	tt := []struct {
+		name       string
+		goroutines int
+		sites      int
+		expected   int
+		clamped    bool
+	}{
+		{name: "fewer goroutines", goroutines: 5, sites: 10, expected: 5},
+		{name: "as many as sites", goroutines: 10, sites: 10, expected: 10},
+		{name: "more goroutines", goroutines: 100, sites: 10, expected: 10, clamped: true},
+		{name: "no sites", goroutines: 100, sites: 0, expected: 100},
 	}
 
-	c := &http.Client{}
 	for _, tc := range tt {
 		t.Run(tc.name, func(t *testing.T) {
-			status, err := makeRequest(c, tc.url, "")
-			if err != nil && !tc.expectedToFail {
+			n, clamped := clampGoroutines(tc.goroutines, tc.sites)
+			if n != tc.expected || clamped != tc.clamped {
+				t.Fatalf("expected %v goroutines and clamped=%v. got=%v and %v", tc.expected, tc.clamped, n, clamped)
+			}
+		})
+	}
+}
+
+func TestReadAgents(t *testing.T) {
+	tt := []struct {
+		name     string
+		data     string
+		expected []string
+		fail     bool
+	}{
+		{name: "one agent", data: "Mozilla/5.0 (X11)", expected: []string{"Mozilla/5.0 (X11)"}},
+		{name: "several agents", data: "Mozilla/5.0 (X11)\r\n\n  curl/7.68.0  \n", expected: []string{"Mozilla/5.0 (X11)", "curl/7.68.0"}},
+		{name: "empty", data: "", fail: true},
+		{name: "only blank lines", data: "\n  \n\t\n", fail: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			agents, err := readAgents(strings.NewReader(tc.data))
+			if (err != nil) != tc.fail {
+				t.Fatalf("expected to fail: %v. got err=%v", tc.fail, err)
+			}
+
+			if !reflect.DeepEqual(agents, tc.expected) {
+				t.Fatalf("expected %q. got=%q", tc.expected, agents)
+			}
+		})
+	}
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	tt := []struct {
+		s        string
+		expected uint16
+		fail     bool
+	}{
+		{s: "", expected: 0},
+		{s: "1.0", expected: tls.VersionTLS10},
+		{s: "1.2", expected: tls.VersionTLS12},
+		{s: " 1.3 ", expected: tls.VersionTLS13},
+		{s: "1.4", fail: true},
+		{s: "TLS1.2", fail: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.s, func(t *testing.T) {
+			v, err := parseTLSVersion(tc.s)
+			if tc.fail {
+				if err == nil {
+					t.Fatalf("expected to fail with %q", tc.s)
+				}
+				return
+			}
+
+			if err != nil {
 				t.Fatalf("not expected to fail: %v", err)
 			}
 
-			if status != tc.expectedStatusCode {
-				t.Fatalf("expected a %v as status code. got=%v", tc.expectedStatusCode, status)
+			if v != tc.expected {
+				t.Fatalf("expected version %x. got=%x", tc.expected, v)
 			}
 		})
 	}
 }
 
-func TestReplaceURL(t *testing.T) {
+func TestConfirm(t *testing.T) {
 	tt := []struct {
-		old      string
-		new      string
-		expected string
+		name     string
+		answer   string
+		expected bool
 	}{
-		{
-			old:      "$",
-			new:      "me",
-			expected: "me",
-		},
-		{
-			old:      "$$$y",
-			new:      "me",
-			expected: "me$$y",
-		},
-		{
-			old:      "https://$.com",
-			new:      "me",
-			expected: "https://me.com",
-		},
-		{
-			old:      "",
-			new:      "",
-			expected: "",
-		},
+		{name: "yes", answer: "yes\n", expected: true},
+		{name: "short yes", answer: " Y \n", expected: true},
+		{name: "no", answer: "n\n", expected: false},
+		{name: "empty", answer: "\n", expected: false},
+		{name: "eof", answer: "", expected: false},
 	}
 
 	for _, tc := range tt {
-		t.Run(tc.expected, func(t *testing.T) {
-			url := replaceURL(tc.old, tc.new)
-			if url != tc.expected {
-				t.Fatalf("expected %q as result. got=%q", tc.expected, url)
+		t.Run(tc.name, func(t *testing.T) {
+			var w strings.Builder
+			ok, err := confirm(strings.NewReader(tc.answer), &w, 5000, 10)
+			if err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+
+			if ok != tc.expected {
+				t.Fatalf("expected %v as answer. got=%v", tc.expected, ok)
+			}
+
+			if !strings.Contains(w.String(), "5000 sites with 10 goroutines") {
+				t.Fatalf("expected prompt to show the number of sites and goroutines. got=%q", w.String())
 			}
 		})
 	}
@@ -0,0 +1,1105 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danielkvist/beagle/scan"
+)
+
+// Fields of a line of a .csv file. Only the name, mainURL
+// and userURL are required, the rest are optional.
+const (
+	fieldName = iota
+	fieldMainURL
+	fieldUserURL
+	fieldErrorString
+	fieldHeaders
+	fieldFoundStatus
+	fieldInvert
+	fieldUserPattern
+	fieldNormalize
+	fieldCookies
+	fieldNotFoundSize
+	fieldTimeout
+	fieldBasicAuth
+	fieldMethod
+	fieldBody
+	fieldFoundMatch
+	fieldFoundHeader
+	fieldNotFoundRedirect
+	fieldMinSize
+	fieldErrorStrings
+	fieldErrorMode
+	fieldDetector
+	numFields
+)
+
+// normalizers are the transformations that can
+// be applied to the usernames of a site.
+var normalizers = map[string]func(string) string{
+	"lowercase": strings.ToLower,
+	"nodots": func(s string) string {
+		return strings.ReplaceAll(s, ".", "")
+	},
+}
+
+// definition defines a site as it is read from a file,
+// before being expanded for each one of the usernames.
+type definition struct {
+	site *scan.Site
+	// normalize are the names of the normalizers
+	// applied to the usernames of the site.
+	normalize []string
+}
+
+// openFile opens the file at path. If path is an http or https
+// URL the file is downloaded with c instead, and if it is "-"
+// the file is read from the standard input.
+func openFile(c *http.Client, path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return openStdin(os.Stdin)
+	}
+
+	u, err := url.Parse(path)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return os.Open(path)
+	}
+
+	resp, err := c.Get(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return resp.Body, nil
+}
+
+// openStdin returns a reader for stdin, which is not closed
+// by the returned io.ReadCloser, or an error if it is empty.
+func openStdin(stdin io.Reader) (io.ReadCloser, error) {
+	r := bufio.NewReader(stdin)
+	if _, err := r.Peek(1); err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("standard input is empty")
+		}
+		return nil, err
+	}
+
+	return ioutil.NopCloser(r), nil
+}
+
+// parseOptions defines how the sites of a file are parsed.
+type parseOptions struct {
+	// users are the usernames for which each site is expanded.
+	users []string
+	// placeholder is the token of the URLs that is
+	// replaced by the username. If empty, "$" is used.
+	placeholder string
+	// skipInvalid makes the parsers skip invalid sites
+	// instead of returning an error.
+	skipInvalid bool
+	// log, if not nil, is used to print the skipped sites.
+	log *logger
+	// delimiter separates the fields of a .csv file.
+	// If 0, a comma is used.
+	delimiter rune
+	// comment, if not 0, marks the lines of a
+	// .csv file that are ignored.
+	comment rune
+	// urlEncode makes the usernames be percent-encoded before
+	// replacing the placeholder of the URLs and the body.
+	urlEncode bool
+	// lines, if greater than 0, is the expected number of
+	// sites of the file, used to preallocate the sites.
+	lines int
+	// hasHeader makes the first line of a .csv file be
+	// skipped, even if it does not look like a header.
+	hasHeader bool
+}
+
+// readAndParseCSV reads the sites from r and returns one site for
+// each of them and each one of the users of opts, along with the
+// number of invalid lines that have been skipped.
+func readAndParseCSV(r *csv.Reader, opts *parseOptions) ([]*scan.Site, int, error) {
+	r.FieldsPerRecord = -1
+	// The fields of each line are kept as strings by the sites,
+	// so the slice that holds them can be reused.
+	r.ReuseRecord = true
+
+	sites := make([]*scan.Site, 0, opts.lines*len(opts.users))
+	var skipped int
+	for first := true; ; first = false {
+		line, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err == nil && first && (opts.hasHeader || isHeader(line)) {
+			opts.log.printf(levelVerbose, "skipping header %v", line)
+			continue
+		}
+
+		var def *definition
+		if err == nil {
+			def, err = parseLine(line)
+		}
+
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); !ok {
+				err = fmt.Errorf("line %v %v", line, err)
+			}
+
+			if !opts.skipInvalid {
+				return nil, skipped, err
+			}
+
+			opts.log.printf(levelInfo, "skipping invalid site: %v", err)
+			skipped++
+			continue
+		}
+
+		sites = expand(sites, def, opts)
+	}
+
+	return sites, skipped, nil
+}
+
+// isHeader reports whether line looks like the header of a
+// .csv file: its first field is "name" and its mainURL and
+// userURL fields are not URLs, like "name,mainURL,userURL".
+func isHeader(line []string) bool {
+	if len(line) <= fieldUserURL || !strings.EqualFold(strings.TrimSpace(line[fieldName]), "name") {
+		return false
+	}
+
+	return !strings.Contains(line[fieldMainURL], "://") && !strings.Contains(line[fieldUserURL], "://")
+}
+
+// parseLine parses a line of a .csv file.
+func parseLine(line []string) (*definition, error) {
+	if len(line) <= fieldUserURL || len(line) > numFields {
+		return nil, fmt.Errorf("has wrong number of fields")
+	}
+
+	for _, f := range line[:fieldUserURL+1] {
+		if strings.TrimSpace(f) == "" {
+			return nil, fmt.Errorf("has an empty name, mainURL or userURL")
+		}
+	}
+
+	headers, err := parseHeaders(field(line, fieldHeaders))
+	if err != nil {
+		return nil, fmt.Errorf("has invalid headers: %v", err)
+	}
+
+	foundStatus, err := parseStatusCodes(field(line, fieldFoundStatus), ";")
+	if err != nil {
+		return nil, fmt.Errorf("has invalid status codes: %v", err)
+	}
+
+	invert, err := parseBool(field(line, fieldInvert))
+	if err != nil {
+		return nil, fmt.Errorf("has an invalid invert field: %v", err)
+	}
+
+	var userPattern *regexp.Regexp
+	if p := field(line, fieldUserPattern); p != "" {
+		userPattern, err = regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("has an invalid username pattern: %v", err)
+		}
+	}
+
+	normalize, err := parseNormalize(splitList(field(line, fieldNormalize)))
+	if err != nil {
+		return nil, err
+	}
+
+	cookies, err := parseCookies(splitList(field(line, fieldCookies)))
+	if err != nil {
+		return nil, fmt.Errorf("has invalid cookies: %v", err)
+	}
+
+	notFoundSize, err := parseSizeRange(field(line, fieldNotFoundSize))
+	if err != nil {
+		return nil, fmt.Errorf("has an invalid not found size: %v", err)
+	}
+
+	timeout, err := parseTimeout(field(line, fieldTimeout))
+	if err != nil {
+		return nil, fmt.Errorf("has an invalid timeout: %v", err)
+	}
+
+	basicAuth, err := parseCredentials(field(line, fieldBasicAuth))
+	if err != nil {
+		return nil, fmt.Errorf("has invalid basic auth credentials: %v", err)
+	}
+
+	method := strings.ToUpper(strings.TrimSpace(field(line, fieldMethod)))
+
+	foundMatch, err := parseMatcher(field(line, fieldFoundMatch))
+	if err != nil {
+		return nil, fmt.Errorf("has an invalid found match: %v", err)
+	}
+
+	foundHeader, err := parseHeaderMatcher(field(line, fieldFoundHeader))
+	if err != nil {
+		return nil, fmt.Errorf("has an invalid found header: %v", err)
+	}
+
+	notFoundRedirect, err := parseRedirectTarget(field(line, fieldNotFoundRedirect))
+	if err != nil {
+		return nil, fmt.Errorf("has an invalid not found redirect: %v", err)
+	}
+
+	minSize, err := parseSize(field(line, fieldMinSize))
+	if err != nil {
+		return nil, fmt.Errorf("has an invalid min size: %v", err)
+	}
+
+	errorMatchAll, err := parseErrorMode(field(line, fieldErrorMode))
+	if err != nil {
+		return nil, err
+	}
+
+	return &definition{
+		site: &scan.Site{
+			Name:             line[fieldName],
+			MainURL:          line[fieldMainURL],
+			UserURL:          line[fieldUserURL],
+			ErrorString:      field(line, fieldErrorString),
+			Headers:          headers,
+			FoundStatus:      foundStatus,
+			Invert:           invert,
+			UserPattern:      userPattern,
+			Cookies:          cookies,
+			NotFoundSize:     notFoundSize,
+			Timeout:          timeout,
+			BasicAuth:        basicAuth,
+			Method:           method,
+			Body:             field(line, fieldBody),
+			FoundMatch:       foundMatch,
+			FoundHeader:      foundHeader,
+			NotFoundRedirect: notFoundRedirect,
+			MinSize:          minSize,
+			ErrorStrings:     splitList(field(line, fieldErrorStrings)),
+			ErrorMatchAll:    errorMatchAll,
+			Detector:         strings.Fields(field(line, fieldDetector)),
+		},
+		normalize: normalize,
+	}, nil
+}
+
+// jsonSite defines a site in a .json file.
+type jsonSite struct {
+	Name        string            `json:"name"`
+	MainURL     string            `json:"mainURL"`
+	UserURL     string            `json:"userURL"`
+	ErrorString string            `json:"errorString"`
+	Headers     map[string]string `json:"headers"`
+	FoundStatus []int             `json:"foundStatus"`
+	Invert      bool              `json:"invert"`
+	UserPattern string            `json:"userPattern"`
+	Normalize   []string          `json:"normalize"`
+	Cookies     map[string]string `json:"cookies"`
+	// NotFoundSize has the same format as
+	// the notFoundSize field of a .csv file.
+	NotFoundSize string `json:"notFoundSize"`
+	// Timeout is a duration like "10s".
+	Timeout string `json:"timeout"`
+	// BasicAuth has the format "username:password".
+	BasicAuth string `json:"basicAuth"`
+	Method    string `json:"method"`
+	Body      string `json:"body"`
+	// FoundMatch has the same format as
+	// the foundMatch field of a .csv file.
+	FoundMatch string `json:"foundMatch"`
+	// FoundHeader has the same format as
+	// the foundHeader field of a .csv file.
+	FoundHeader string `json:"foundHeader"`
+	// NotFoundRedirect has the same format as
+	// the notFoundRedirect field of a .csv file.
+	NotFoundRedirect string   `json:"notFoundRedirect"`
+	MinSize          int64    `json:"minSize"`
+	ErrorStrings     []string `json:"errorStrings"`
+	// ErrorMode has the same format as
+	// the errorMode field of a .csv file.
+	ErrorMode string `json:"errorMode"`
+	// Detector has the same format as
+	// the detector field of a .csv file.
+	Detector string `json:"detector"`
+}
+
+// readAndParseJSON reads a JSON array of sites from r and returns
+// one site for each of them and each one of the users of opts, along
+// with the number of invalid sites that have been skipped.
+func readAndParseJSON(r io.Reader, opts *parseOptions) ([]*scan.Site, int, error) {
+	var defs []jsonSite
+	if err := json.NewDecoder(r).Decode(&defs); err != nil {
+		return nil, 0, err
+	}
+
+	sites := []*scan.Site{}
+	var skipped int
+	for i, d := range defs {
+		def, err := d.definition()
+		if err != nil {
+			err = fmt.Errorf("site %d %v", i, err)
+			if !opts.skipInvalid {
+				return nil, skipped, err
+			}
+
+			opts.log.printf(levelInfo, "skipping invalid site: %v", err)
+			skipped++
+			continue
+		}
+
+		sites = expand(sites, def, opts)
+	}
+
+	return sites, skipped, nil
+}
+
+func (d *jsonSite) definition() (*definition, error) {
+	if d.Name == "" || d.MainURL == "" || d.UserURL == "" {
+		return nil, fmt.Errorf("must have a name, a mainURL and a userURL")
+	}
+
+	var headers http.Header
+	if len(d.Headers) > 0 {
+		headers = http.Header{}
+		for k, v := range d.Headers {
+			headers.Set(k, v)
+		}
+	}
+
+	var userPattern *regexp.Regexp
+	if d.UserPattern != "" {
+		var err error
+		userPattern, err = regexp.Compile(d.UserPattern)
+		if err != nil {
+			return nil, fmt.Errorf("has an invalid username pattern: %v", err)
+		}
+	}
+
+	for _, code := range d.FoundStatus {
+		if code < 100 || code > 599 {
+			return nil, fmt.Errorf("has an invalid status code %d", code)
+		}
+	}
+
+	normalize, err := parseNormalize(d.Normalize)
+	if err != nil {
+		return nil, err
+	}
+
+	var cookies []*http.Cookie
+	for name, value := range d.Cookies {
+		if strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("has a cookie without name")
+		}
+		cookies = append(cookies, &http.Cookie{Name: strings.TrimSpace(name), Value: value})
+	}
+
+	notFoundSize, err := parseSizeRange(d.NotFoundSize)
+	if err != nil {
+		return nil, fmt.Errorf("has an invalid not found size: %v", err)
+	}
+
+	timeout, err := parseTimeout(d.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("has an invalid timeout: %v", err)
+	}
+
+	basicAuth, err := parseCredentials(d.BasicAuth)
+	if err != nil {
+		return nil, fmt.Errorf("has invalid basic auth credentials: %v", err)
+	}
+
+	foundMatch, err := parseMatcher(d.FoundMatch)
+	if err != nil {
+		return nil, fmt.Errorf("has an invalid found match: %v", err)
+	}
+
+	foundHeader, err := parseHeaderMatcher(d.FoundHeader)
+	if err != nil {
+		return nil, fmt.Errorf("has an invalid found header: %v", err)
+	}
+
+	notFoundRedirect, err := parseRedirectTarget(d.NotFoundRedirect)
+	if err != nil {
+		return nil, fmt.Errorf("has an invalid not found redirect: %v", err)
+	}
+
+	if d.MinSize < 0 {
+		return nil, fmt.Errorf("has an invalid min size %d", d.MinSize)
+	}
+
+	errorMatchAll, err := parseErrorMode(d.ErrorMode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &definition{
+		site: &scan.Site{
+			Name:             d.Name,
+			MainURL:          d.MainURL,
+			UserURL:          d.UserURL,
+			ErrorString:      d.ErrorString,
+			Headers:          headers,
+			FoundStatus:      d.FoundStatus,
+			Invert:           d.Invert,
+			UserPattern:      userPattern,
+			Cookies:          cookies,
+			NotFoundSize:     notFoundSize,
+			Timeout:          timeout,
+			BasicAuth:        basicAuth,
+			Method:           strings.ToUpper(strings.TrimSpace(d.Method)),
+			Body:             d.Body,
+			FoundMatch:       foundMatch,
+			FoundHeader:      foundHeader,
+			NotFoundRedirect: notFoundRedirect,
+			MinSize:          d.MinSize,
+			ErrorStrings:     d.ErrorStrings,
+			ErrorMatchAll:    errorMatchAll,
+			Detector:         strings.Fields(d.Detector),
+		},
+		normalize: normalize,
+	}, nil
+}
+
+// parseSites reads the sites from r using format, which can be
+// "csv" or "json", and returns one site for each of them and each
+// one of the users of opts, along with the number of invalid
+// sites that have been skipped.
+func parseSites(r io.Reader, format string, opts *parseOptions) ([]*scan.Site, int, error) {
+	switch format {
+	case "csv":
+		// The whole file is read first to count its lines
+		// and preallocate the sites for all of them.
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		withLines := *opts
+		withLines.lines = bytes.Count(data, []byte{'\n'}) + 1
+		opts = &withLines
+
+		cr := csv.NewReader(bytes.NewReader(data))
+		if opts.delimiter != 0 {
+			cr.Comma = opts.delimiter
+		}
+		cr.Comment = opts.comment
+		return readAndParseCSV(cr, opts)
+	case "json":
+		return readAndParseJSON(r, opts)
+	default:
+		return nil, 0, fmt.Errorf("format %q is not valid, use \"csv\" or \"json\"", format)
+	}
+}
+
+// readFiles opens, with c if needed, and parses each one of the
+// files at paths with format, detected from their extension if
+// it is empty, and returns all their sites one after the other.
+func readFiles(c *http.Client, paths []string, format string, opts *parseOptions) ([]*scan.Site, error) {
+	var sites []*scan.Site
+	for _, path := range paths {
+		fileSites, err := readFile(c, path, format, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		sites = append(sites, fileSites...)
+	}
+
+	return sites, nil
+}
+
+func readFile(c *http.Client, path string, format string, opts *parseOptions) ([]*scan.Site, error) {
+	f, err := openFile(c, path)
+	if err != nil {
+		return nil, fmt.Errorf("while opening file %q: %v", path, err)
+	}
+	defer f.Close()
+
+	if format == "" {
+		format = detectFormat(path)
+	}
+
+	sites, skipped, err := parseSites(f, format, opts)
+	if err != nil {
+		return nil, fmt.Errorf("while reading file %q: %v", path, err)
+	}
+
+	if skipped > 0 {
+		opts.log.printf(levelInfo, "%d invalid sites skipped from file %q", skipped, path)
+	}
+
+	if len(sites) == 0 {
+		return nil, fmt.Errorf("file %q is empty or is not valid", path)
+	}
+
+	return sites, nil
+}
+
+// detectFormat returns the format of the file at
+// path based on its extension. If the extension is
+// not .json it returns "csv".
+func detectFormat(path string) string {
+	if u, err := url.Parse(path); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		path = u.Path
+	}
+
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		return "json"
+	}
+
+	return "csv"
+}
+
+// expand appends to sites a copy of the site of def for each
+// one of the users of opts with the placeholders of its URLs
+// replaced by the normalized username, and returns them.
+func expand(sites []*scan.Site, def *definition, opts *parseOptions) []*scan.Site {
+	placeholder := opts.placeholder
+	if placeholder == "" {
+		placeholder = "$"
+	}
+
+	replace := replaceURL
+	if opts.urlEncode {
+		replace = replaceEncodedURL
+	}
+
+	// The copies are allocated at once instead of one by one.
+	copies := make([]scan.Site, len(opts.users))
+	for i, user := range opts.users {
+		name := normalizeUser(user, def.normalize)
+		bodyName := name
+		if opts.urlEncode {
+			bodyName = url.QueryEscape(name)
+		}
+
+		s := &copies[i]
+		*s = *def.site
+		s.MainURL = replace(def.site.MainURL, placeholder, name)
+		s.UserURL = replace(def.site.UserURL, placeholder, name)
+		s.Body = replaceURL(def.site.Body, placeholder, bodyName)
+		s.User = user
+		sites = append(sites, s)
+	}
+
+	return sites
+}
+
+// filterSites returns the sites whose name, ignoring the case, is
+// one of only, if it is not empty, and is not one of exclude.
+func filterSites(sites []*scan.Site, only []string, exclude []string) []*scan.Site {
+	onlySet := nameSet(only)
+	excludeSet := nameSet(exclude)
+
+	filtered := make([]*scan.Site, 0, len(sites))
+	for _, s := range sites {
+		name := strings.ToLower(s.Name)
+		if len(onlySet) > 0 && !onlySet[name] {
+			continue
+		}
+
+		if excludeSet[name] {
+			continue
+		}
+
+		filtered = append(filtered, s)
+	}
+
+	return filtered
+}
+
+// filterDomains returns the sites whose mainURL host, ignoring the
+// case, is one of domains or a subdomain of one of them.
+func filterDomains(sites []*scan.Site, domains []string) []*scan.Site {
+	var suffixes []string
+	for _, d := range domains {
+		d = strings.Trim(strings.ToLower(strings.TrimSpace(d)), ".")
+		if d != "" {
+			suffixes = append(suffixes, d)
+		}
+	}
+
+	filtered := make([]*scan.Site, 0, len(sites))
+	for _, s := range sites {
+		u, err := url.Parse(s.MainURL)
+		if err != nil {
+			continue
+		}
+
+		host := strings.ToLower(u.Hostname())
+		for _, d := range suffixes {
+			if host == d || strings.HasSuffix(host, "."+d) {
+				filtered = append(filtered, s)
+				break
+			}
+		}
+	}
+
+	return filtered
+}
+
+func nameSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, n := range names {
+		if n = strings.TrimSpace(n); n != "" {
+			set[strings.ToLower(n)] = true
+		}
+	}
+
+	return set
+}
+
+// dedupe returns sites without the ones that have the same
+// username, mainURL and userURL as a previous one, along with
+// the number of sites that have been removed.
+func dedupe(sites []*scan.Site) ([]*scan.Site, int) {
+	seen := make(map[[3]string]bool, len(sites))
+	unique := make([]*scan.Site, 0, len(sites))
+	for _, s := range sites {
+		key := [3]string{s.User, s.MainURL, s.UserURL}
+		if seen[key] {
+			continue
+		}
+
+		seen[key] = true
+		unique = append(unique, s)
+	}
+
+	return unique, len(sites) - len(unique)
+}
+
+// shuffleSites randomizes the order of sites
+// using a source of random numbers with seed.
+func shuffleSites(sites []*scan.Site, seed int64) {
+	r := rand.New(rand.NewSource(seed))
+	r.Shuffle(len(sites), func(i, j int) {
+		sites[i], sites[j] = sites[j], sites[i]
+	})
+}
+
+// parseNormalize checks that all the received
+// names are valid normalizers and returns them.
+func parseNormalize(names []string) ([]string, error) {
+	for _, n := range names {
+		if _, ok := normalizers[n]; !ok {
+			return nil, fmt.Errorf("has an unknown normalizer %q, use \"lowercase\" or \"nodots\"", n)
+		}
+	}
+
+	return names, nil
+}
+
+// normalizeUser applies to user the normalizers
+// with the received names in order.
+func normalizeUser(user string, names []string) string {
+	for _, n := range names {
+		user = normalizers[n](user)
+	}
+
+	return user
+}
+
+// splitList splits a list of values separated by ";"
+// ignoring the empty ones.
+func splitList(s string) []string {
+	var values []string
+	for _, v := range strings.Split(s, ";") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
+
+// field returns the field i of line or an
+// empty string if line does not have it.
+func field(line []string, i int) string {
+	if i >= len(line) {
+		return ""
+	}
+
+	return line[i]
+}
+
+// parseHeaders parses a list of headers with the
+// format "key:value;key:value". An empty string
+// returns no headers.
+func parseHeaders(s string) (http.Header, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	headers := http.Header{}
+	for _, pair := range strings.Split(s, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, ":", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("header %q is not valid, use the format key:value", pair)
+		}
+
+		headers.Set(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+	}
+
+	return headers, nil
+}
+
+// parseHeaderValues parses a list of headers with the format
+// "key:value". Repeated keys keep all their values. An empty
+// list returns no headers.
+func parseHeaderValues(values []string) (http.Header, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	headers := http.Header{}
+	for _, v := range values {
+		kv := strings.SplitN(v, ":", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("header %q is not valid, use the format key:value", v)
+		}
+
+		headers.Add(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+	}
+
+	return headers, nil
+}
+
+// parseCookies parses a list of cookies with the
+// format "name=value". An empty list returns no cookies.
+func parseCookies(values []string) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+	for _, v := range values {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("cookie %q is not valid, use the format name=value", v)
+		}
+
+		cookies = append(cookies, &http.Cookie{Name: strings.TrimSpace(kv[0]), Value: strings.TrimSpace(kv[1])})
+	}
+
+	return cookies, nil
+}
+
+// parseSizeRange parses a size in bytes, like "1024", or
+// an inclusive range of sizes, like "1000-1100". An
+// empty string returns a nil range.
+func parseSizeRange(s string) (*scan.SizeRange, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	bounds := strings.SplitN(s, "-", 2)
+	min, err := strconv.ParseInt(strings.TrimSpace(bounds[0]), 10, 64)
+	if err != nil || min < 0 {
+		return nil, fmt.Errorf("size %q is not valid", s)
+	}
+
+	max := min
+	if len(bounds) == 2 {
+		max, err = strconv.ParseInt(strings.TrimSpace(bounds[1]), 10, 64)
+		if err != nil || max < min {
+			return nil, fmt.Errorf("size range %q is not valid", s)
+		}
+	}
+
+	return &scan.SizeRange{Min: min, Max: max}, nil
+}
+
+// parseSize parses a size in bytes, like "1024".
+// An empty string returns 0.
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	size, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("size %q is not valid", s)
+	}
+
+	return size, nil
+}
+
+// parseErrorMode parses how the error strings of a site are
+// matched, "any" or "all", and reports whether all of them
+// must be present. An empty string is the same as "any".
+func parseErrorMode(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "any":
+		return false, nil
+	case "all":
+		return true, nil
+	default:
+		return false, fmt.Errorf("has an invalid error mode %q, use any or all", s)
+	}
+}
+
+// parseRedirectTarget parses the URL to which a site
+// redirects the missing profiles, like "https://site.com/".
+// An empty string returns a nil URL.
+func parseRedirectTarget(s string) (*url.URL, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("URL %q is not valid, it must have a scheme and a host", s)
+	}
+
+	return u, nil
+}
+
+// parseTimeout parses a positive duration, like
+// "10s". An empty string returns 0.
+func parseTimeout(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("timeout %q must be positive", s)
+	}
+
+	return d, nil
+}
+
+// parseCredentials parses basic auth credentials with the
+// format "username:password". An empty string returns nil.
+func parseCredentials(s string) (*scan.Credentials, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	up := strings.SplitN(s, ":", 2)
+	if len(up) != 2 || up[0] == "" {
+		return nil, fmt.Errorf("use the format username:password")
+	}
+
+	return &scan.Credentials{Username: up[0], Password: up[1]}, nil
+}
+
+// csvOptions returns the parseOptions with the delimiter and the
+// comment character of a .csv file parsed from their flags.
+func csvOptions(delimiter, comment string) (*parseOptions, error) {
+	comma, err := parseRune(delimiter)
+	if err != nil || comma == 0 {
+		return nil, fmt.Errorf("delimiter %q is not valid, use a single character", delimiter)
+	}
+
+	commentChar, err := parseRune(comment)
+	if err != nil {
+		return nil, fmt.Errorf("comment %q is not valid, use a single character", comment)
+	}
+
+	return &parseOptions{delimiter: comma, comment: commentChar}, nil
+}
+
+// parseRune parses a single character, or "\t" for a tab.
+// An empty string returns 0.
+func parseRune(s string) (rune, error) {
+	if s == `\t` {
+		return '\t', nil
+	}
+
+	runes := []rune(s)
+	switch len(runes) {
+	case 0:
+		return 0, nil
+	case 1:
+		return runes[0], nil
+	default:
+		return 0, fmt.Errorf("%q is not a single character", s)
+	}
+}
+
+// parseMatcher parses a found match, which can be "re:" followed
+// by a regular expression or "json:" followed by a path of keys
+// separated by dots and, optionally, "=" and the expected value,
+// like "json:data.exists=true". An empty string returns nil.
+func parseMatcher(s string) (scan.Matcher, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "":
+		return nil, nil
+	case strings.HasPrefix(s, "re:"):
+		re, err := regexp.Compile(strings.TrimPrefix(s, "re:"))
+		if err != nil {
+			return nil, err
+		}
+		return &scan.RegexpMatcher{Regexp: re}, nil
+	case strings.HasPrefix(s, "json:"):
+		pv := strings.SplitN(strings.TrimPrefix(s, "json:"), "=", 2)
+		path := strings.Split(pv[0], ".")
+		for _, key := range path {
+			if key == "" {
+				return nil, fmt.Errorf("JSON path %q has an empty key", pv[0])
+			}
+		}
+
+		m := &scan.JSONMatcher{Path: path}
+		if len(pv) == 2 {
+			m.Value = pv[1]
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("%q must start with \"re:\" or \"json:\"", s)
+	}
+}
+
+// parseHeaderMatcher parses a found header, which is the
+// name of a header that must be present, optionally followed
+// by ":" and a regular expression that one of its values must
+// match, like "Location:/users/". An empty string returns nil.
+func parseHeaderMatcher(s string) (*scan.HeaderMatcher, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	np := strings.SplitN(s, ":", 2)
+	m := &scan.HeaderMatcher{Name: strings.TrimSpace(np[0])}
+	if m.Name == "" {
+		return nil, fmt.Errorf("%q has an empty header name", s)
+	}
+
+	if len(np) == 2 {
+		re, err := regexp.Compile(np[1])
+		if err != nil {
+			return nil, err
+		}
+		m.Pattern = re
+	}
+
+	return m, nil
+}
+
+// parseStatusCodes parses a list of HTTP status codes
+// separated by sep. An empty string returns no codes.
+func parseStatusCodes(s string, sep string) ([]int, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var codes []int
+	for _, c := range strings.Split(s, sep) {
+		code, err := strconv.Atoi(strings.TrimSpace(c))
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("status code %q is not valid", c)
+		}
+
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// parseBool parses a boolean field.
+// An empty string returns false.
+func parseBool(s string) (bool, error) {
+	if strings.TrimSpace(s) == "" {
+		return false, nil
+	}
+
+	return strconv.ParseBool(strings.TrimSpace(s))
+}
+
+func cleanUsers(users []string) []string {
+	cleaned := []string{}
+	for _, u := range users {
+		u = strings.TrimSpace(u)
+		if u != "" {
+			cleaned = append(cleaned, u)
+		}
+	}
+
+	return cleaned
+}
+
+// replaceURL replaces all the occurrences
+// of placeholder in s with new.
+func replaceURL(s, placeholder, new string) string {
+	return strings.ReplaceAll(s, placeholder, new)
+}
+
+// replaceEncodedURL replaces all the occurrences of placeholder
+// in s with new percent-encoded for the part of the URL in which
+// they are: escaped as a query value after the "?", as a path
+// segment after the host and left as it is on the host.
+func replaceEncodedURL(s, placeholder, new string) string {
+	if placeholder == "" {
+		return s
+	}
+
+	var b strings.Builder
+	for {
+		i := strings.Index(s, placeholder)
+		if i < 0 {
+			break
+		}
+
+		b.WriteString(s[:i])
+		prefix := b.String()
+		if j := strings.Index(prefix, "://"); j >= 0 {
+			prefix = prefix[j+len("://"):]
+		}
+
+		switch {
+		case strings.ContainsAny(prefix, "?#"):
+			b.WriteString(url.QueryEscape(new))
+		case strings.Contains(prefix, "/"):
+			b.WriteString(url.PathEscape(new))
+		default:
+			b.WriteString(new)
+		}
+		s = s[i+len(placeholder):]
+	}
+	b.WriteString(s)
+
+	return b.String()
+}
+
+// needsEncoding reports whether user has characters
+// that must be percent-encoded on the path of a URL.
+func needsEncoding(user string) bool {
+	return url.PathEscape(user) != user
+}
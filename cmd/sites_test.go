@@ -0,0 +1,1274 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielkvist/beagle/scan"
+)
+
+func TestOpenFile(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/urls.csv" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(".com,https://$.com,https://$.com"))
+	}))
+	defer ts.Close()
+
+	tt := []struct {
+		name           string
+		path           string
+		expectedToFail bool
+	}{
+		{
+			name: "url",
+			path: ts.URL + "/urls.csv",
+		},
+		{
+			name:           "url not found",
+			path:           ts.URL + "/missing.csv",
+			expectedToFail: true,
+		},
+		{
+			name: "path",
+			path: "../urls.csv",
+		},
+		{
+			name:           "path not found",
+			path:           "./missing.csv",
+			expectedToFail: true,
+		},
+	}
+
+	c := &http.Client{}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := openFile(c, tc.path)
+			if err != nil {
+				if !tc.expectedToFail {
+					t.Fatalf("not expected to fail: %v", err)
+				}
+				return
+			}
+			defer f.Close()
+
+			if tc.expectedToFail {
+				t.Fatalf("expected to fail")
+			}
+
+			sites, _, err := readAndParseCSV(csv.NewReader(f), &parseOptions{users: []string{"me"}})
+			if err != nil {
+				t.Fatalf("while reading and parsing .csv: %v", err)
+			}
+
+			if len(sites) == 0 {
+				t.Fatalf("expected at least one site")
+			}
+		})
+	}
+}
+
+func TestReadFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "beagle")
+	if err != nil {
+		t.Fatalf("while creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	social := filepath.Join(dir, "social.csv")
+	gaming := filepath.Join(dir, "gaming.json")
+	invalid := filepath.Join(dir, "invalid.csv")
+	files := map[string]string{
+		social:  "github,https://github.com/$,https://github.com/$\ngitlab,https://gitlab.com/$,https://gitlab.com/$",
+		gaming:  `[{"name": "steam", "mainURL": "https://steamcommunity.com/id/$", "userURL": "https://steamcommunity.com/id/$"}]`,
+		invalid: "github,https://github.com/$",
+	}
+	for path, data := range files {
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("while writing file %q: %v", path, err)
+		}
+	}
+
+	sites, err := readFiles(&http.Client{}, []string{social, gaming}, "", &parseOptions{users: []string{"me"}})
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	var names []string
+	for _, s := range sites {
+		names = append(names, s.Name)
+	}
+
+	if got := strings.Join(names, " "); got != "github gitlab steam" {
+		t.Fatalf("expected %q as sites. got=%q", "github gitlab steam", got)
+	}
+
+	_, err = readFiles(&http.Client{}, []string{social, invalid}, "", &parseOptions{users: []string{"me"}})
+	if err == nil || !strings.Contains(err.Error(), invalid) {
+		t.Fatalf("expected to fail naming file %q. got=%v", invalid, err)
+	}
+}
+
+func TestOpenStdin(t *testing.T) {
+	f, err := openStdin(strings.NewReader(".com,https://$.com,https://$.com"))
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+	defer f.Close()
+
+	sites, _, err := parseSites(f, "csv", &parseOptions{users: []string{"me"}})
+	if err != nil {
+		t.Fatalf("while parsing sites from stdin: %v", err)
+	}
+
+	if len(sites) != 1 {
+		t.Fatalf("expected sites to have a length of %v. got=%v", 1, len(sites))
+	}
+
+	if _, err := openStdin(strings.NewReader("")); err == nil {
+		t.Fatalf("expected to fail with an empty stdin")
+	}
+}
+
+func TestReadAndParseCSV(t *testing.T) {
+	var fakeCSV []string
+	var i int
+	for ; i <= 1000; i++ {
+		fakeCSV = append(fakeCSV, ".com,https://$.com,https://$.com")
+	}
+
+	r := csv.NewReader(strings.NewReader(strings.Join(fakeCSV, "\n")))
+	sites, _, err := readAndParseCSV(r, &parseOptions{users: []string{"m"}})
+	if err != nil {
+		t.Fatalf("while reading and parsing fake .csv: %v", err)
+	}
+
+	if len(sites) != i {
+		t.Fatalf("expected sites to have a length of %v. got=%v", i, len(sites))
+	}
+}
+
+func TestReadAndParseCSVSkipInvalid(t *testing.T) {
+	data := strings.Join([]string{
+		".com,https://$.com,https://$.com",
+		".org,https://$.org",
+		",,",
+		".net,https://$.net,https://$.net,,,,maybe",
+		".io,https://$.io,https://$.io",
+	}, "\n")
+
+	if _, _, err := readAndParseCSV(csv.NewReader(strings.NewReader(data)), &parseOptions{users: []string{"me"}}); err == nil {
+		t.Fatalf("expected to fail without skipInvalid")
+	}
+
+	opts := &parseOptions{users: []string{"me"}, skipInvalid: true}
+	sites, skipped, err := readAndParseCSV(csv.NewReader(strings.NewReader(data)), opts)
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	if len(sites) != 2 {
+		t.Fatalf("expected sites to have a length of %v. got=%v", 2, len(sites))
+	}
+
+	if skipped != 3 {
+		t.Fatalf("expected %v skipped lines. got=%v", 3, skipped)
+	}
+}
+
+func TestReadAndParseCSVErrorString(t *testing.T) {
+	r := csv.NewReader(strings.NewReader(".com,https://$.com,https://$.com\n.org,https://$.org,https://$.org,Not Found"))
+	sites, _, err := readAndParseCSV(r, &parseOptions{users: []string{"me"}})
+	if err != nil {
+		t.Fatalf("while reading and parsing fake .csv: %v", err)
+	}
+
+	if len(sites) != 2 {
+		t.Fatalf("expected sites to have a length of %v. got=%v", 2, len(sites))
+	}
+
+	if sites[0].ErrorString != "" {
+		t.Fatalf("expected first site to have no error string. got=%q", sites[0].ErrorString)
+	}
+
+	if sites[1].ErrorString != "Not Found" {
+		t.Fatalf("expected second site to have %q as error string. got=%q", "Not Found", sites[1].ErrorString)
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	tt := []struct {
+		name           string
+		s              string
+		expected       map[string]string
+		expectedToFail bool
+	}{
+		{
+			name:     "empty",
+			s:        "",
+			expected: map[string]string{},
+		},
+		{
+			name:     "one",
+			s:        "Accept:text/html",
+			expected: map[string]string{"Accept": "text/html"},
+		},
+		{
+			name:     "several",
+			s:        "accept: text/html; Referer:https://me.com;",
+			expected: map[string]string{"Accept": "text/html", "Referer": "https://me.com"},
+		},
+		{
+			name:           "no colon",
+			s:              "Accept",
+			expectedToFail: true,
+		},
+		{
+			name:           "no key",
+			s:              ":text/html",
+			expectedToFail: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			headers, err := parseHeaders(tc.s)
+			if err != nil {
+				if !tc.expectedToFail {
+					t.Fatalf("not expected to fail: %v", err)
+				}
+				return
+			}
+
+			if tc.expectedToFail {
+				t.Fatalf("expected to fail")
+			}
+
+			if len(headers) != len(tc.expected) {
+				t.Fatalf("expected %v headers. got=%v", len(tc.expected), len(headers))
+			}
+
+			for k, v := range tc.expected {
+				if headers.Get(k) != v {
+					t.Fatalf("expected header %q to be %q. got=%q", k, v, headers.Get(k))
+				}
+			}
+		})
+	}
+}
+
+func TestParseHeaderValues(t *testing.T) {
+	tt := []struct {
+		name     string
+		values   []string
+		expected http.Header
+		fail     bool
+	}{
+		{name: "empty", values: nil, expected: nil},
+		{name: "valid", values: []string{"Accept-Language: en", "X-Forwarded-For:127.0.0.1"}, expected: http.Header{"Accept-Language": {"en"}, "X-Forwarded-For": {"127.0.0.1"}}},
+		{name: "repeated", values: []string{"Accept:text/html", "accept:*/*"}, expected: http.Header{"Accept": {"text/html", "*/*"}}},
+		{name: "value with colons", values: []string{"Referer:https://me.com"}, expected: http.Header{"Referer": {"https://me.com"}}},
+		{name: "without value", values: []string{"Accept"}, fail: true},
+		{name: "without key", values: []string{":en"}, fail: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			headers, err := parseHeaderValues(tc.values)
+			if tc.fail {
+				if err == nil {
+					t.Fatalf("expected to fail with %q", tc.values)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+
+			if !reflect.DeepEqual(headers, tc.expected) {
+				t.Fatalf("expected headers %v. got=%v", tc.expected, headers)
+			}
+		})
+	}
+}
+
+func TestParseStatusCodes(t *testing.T) {
+	tt := []struct {
+		name           string
+		s              string
+		expected       []int
+		expectedToFail bool
+	}{
+		{
+			name: "empty",
+			s:    "",
+		},
+		{
+			name:     "one",
+			s:        "200",
+			expected: []int{200},
+		},
+		{
+			name:     "several",
+			s:        "200; 301;403",
+			expected: []int{200, 301, 403},
+		},
+		{
+			name:           "not a number",
+			s:              "ok",
+			expectedToFail: true,
+		},
+		{
+			name:           "out of range",
+			s:              "200;999",
+			expectedToFail: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			codes, err := parseStatusCodes(tc.s, ";")
+			if err != nil {
+				if !tc.expectedToFail {
+					t.Fatalf("not expected to fail: %v", err)
+				}
+				return
+			}
+
+			if tc.expectedToFail {
+				t.Fatalf("expected to fail")
+			}
+
+			if !reflect.DeepEqual(codes, tc.expected) {
+				t.Fatalf("expected %v as status codes. got=%v", tc.expected, codes)
+			}
+		})
+	}
+}
+
+func TestReadAndParseCSVInvert(t *testing.T) {
+	r := csv.NewReader(strings.NewReader(".com,https://$.com,https://$.com,,,,true\n.org,https://$.org,https://$.org"))
+	sites, _, err := readAndParseCSV(r, &parseOptions{users: []string{"me"}})
+	if err != nil {
+		t.Fatalf("while reading and parsing fake .csv: %v", err)
+	}
+
+	if !sites[0].Invert {
+		t.Fatalf("expected first site to be inverted")
+	}
+
+	if sites[1].Invert {
+		t.Fatalf("expected second site to not be inverted")
+	}
+
+	r = csv.NewReader(strings.NewReader(".com,https://$.com,https://$.com,,,,maybe"))
+	if _, _, err := readAndParseCSV(r, &parseOptions{users: []string{"me"}}); err == nil {
+		t.Fatalf("expected to fail with an invalid invert field")
+	}
+}
+
+func TestReadAndParseJSON(t *testing.T) {
+	data := `[
+		{"name": ".com", "mainURL": "https://$.com", "userURL": "https://$.com/u"},
+		{
+			"name": ".org",
+			"mainURL": "https://$.org",
+			"userURL": "https://$.org/u",
+			"errorString": "Not Found",
+			"headers": {"accept": "text/html"},
+			"foundStatus": [200, 301],
+			"invert": true,
+			"userPattern": "^[a-z]+$"
+		}
+	]`
+
+	sites, _, err := readAndParseJSON(strings.NewReader(data), &parseOptions{users: []string{"me", "you"}})
+	if err != nil {
+		t.Fatalf("while reading and parsing fake .json: %v", err)
+	}
+
+	if len(sites) != 4 {
+		t.Fatalf("expected sites to have a length of %v. got=%v", 4, len(sites))
+	}
+
+	s := sites[3]
+	if s.UserURL != "https://you.org/u" || s.User != "you" {
+		t.Fatalf("expected last site to be for %q at %q. got=%q at %q", "you", "https://you.org/u", s.User, s.UserURL)
+	}
+
+	if s.ErrorString != "Not Found" || s.Headers.Get("Accept") != "text/html" || !s.Invert || s.UserPattern == nil {
+		t.Fatalf("expected last site to have all its optional fields. got=%+v", s)
+	}
+
+	if !reflect.DeepEqual(s.FoundStatus, []int{200, 301}) {
+		t.Fatalf("expected %v as found status codes. got=%v", []int{200, 301}, s.FoundStatus)
+	}
+
+	if _, _, err := readAndParseJSON(strings.NewReader(`[{"name": ".com"}]`), &parseOptions{users: []string{"me"}}); err == nil {
+		t.Fatalf("expected to fail with a site without URLs")
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tt := []struct {
+		path     string
+		expected string
+	}{
+		{path: "./urls.csv", expected: "csv"},
+		{path: "./urls.json", expected: "json"},
+		{path: "./URLS.JSON", expected: "json"},
+		{path: "./urls", expected: "csv"},
+		{path: "https://me.com/urls.json?raw=true", expected: "json"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.path, func(t *testing.T) {
+			format := detectFormat(tc.path)
+			if format != tc.expected {
+				t.Fatalf("expected %q as format. got=%q", tc.expected, format)
+			}
+		})
+	}
+}
+
+func TestReadAndParseCSVNormalize(t *testing.T) {
+	data := ".com,https://$.com,https://$.com/u,,,,,,lowercase;nodots\n.org,https://$.org,https://$.org/u"
+	sites, _, err := readAndParseCSV(csv.NewReader(strings.NewReader(data)), &parseOptions{users: []string{"John.Doe"}})
+	if err != nil {
+		t.Fatalf("while reading and parsing fake .csv: %v", err)
+	}
+
+	expected := []string{"https://johndoe.com/u", "https://John.Doe.org/u"}
+	for i, s := range sites {
+		if s.UserURL != expected[i] {
+			t.Fatalf("expected site %v to have %q as userURL. got=%q", i, expected[i], s.UserURL)
+		}
+
+		if s.User != "John.Doe" {
+			t.Fatalf("expected site %v to keep %q as user. got=%q", i, "John.Doe", s.User)
+		}
+	}
+
+	data = ".com,https://$.com,https://$.com/u,,,,,,uppercase"
+	if _, _, err := readAndParseCSV(csv.NewReader(strings.NewReader(data)), &parseOptions{users: []string{"me"}}); err == nil {
+		t.Fatalf("expected to fail with an unknown normalizer")
+	}
+}
+
+func TestParseCookies(t *testing.T) {
+	tt := []struct {
+		name     string
+		values   []string
+		expected int
+		fail     bool
+	}{
+		{name: "empty", values: nil, expected: 0},
+		{name: "valid", values: []string{"session=abc", " lang = en "}, expected: 2},
+		{name: "value with equals", values: []string{"token=a=b"}, expected: 1},
+		{name: "without value", values: []string{"session"}, fail: true},
+		{name: "without name", values: []string{"=abc"}, fail: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			cookies, err := parseCookies(tc.values)
+			if tc.fail {
+				if err == nil {
+					t.Fatalf("expected to fail with %q", tc.values)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+
+			if len(cookies) != tc.expected {
+				t.Fatalf("expected %v cookies. got=%v", tc.expected, len(cookies))
+			}
+		})
+	}
+}
+
+func TestReadAndParseCSVCookies(t *testing.T) {
+	data := ".com,https://$.com,https://$.com/u,,,,,,,session=abc;lang=en"
+	sites, _, err := readAndParseCSV(csv.NewReader(strings.NewReader(data)), &parseOptions{users: []string{"me"}})
+	if err != nil {
+		t.Fatalf("while reading and parsing fake .csv: %v", err)
+	}
+
+	cookies := sites[0].Cookies
+	if len(cookies) != 2 || cookies[0].Name != "session" || cookies[0].Value != "abc" || cookies[1].Name != "lang" {
+		t.Fatalf("expected cookies session=abc and lang=en. got=%v", cookies)
+	}
+}
+
+func TestParseSizeRange(t *testing.T) {
+	tt := []struct {
+		name     string
+		s        string
+		expected *scan.SizeRange
+		fail     bool
+	}{
+		{name: "empty", s: ""},
+		{name: "size", s: "1024", expected: &scan.SizeRange{Min: 1024, Max: 1024}},
+		{name: "range", s: " 1000 - 1100 ", expected: &scan.SizeRange{Min: 1000, Max: 1100}},
+		{name: "reversed range", s: "1100-1000", fail: true},
+		{name: "negative", s: "-5", fail: true},
+		{name: "not a number", s: "big", fail: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := parseSizeRange(tc.s)
+			if tc.fail {
+				if err == nil {
+					t.Fatalf("expected to fail with %q", tc.s)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+
+			if (r == nil) != (tc.expected == nil) || (r != nil && *r != *tc.expected) {
+				t.Fatalf("expected %+v as size range. got=%+v", tc.expected, r)
+			}
+		})
+	}
+}
+
+func TestReadAndParseCSVTimeout(t *testing.T) {
+	data := ".com,https://$.com,https://$.com/u,,,,,,,,,10s\n.org,https://$.org,https://$.org/u"
+	sites, _, err := readAndParseCSV(csv.NewReader(strings.NewReader(data)), &parseOptions{users: []string{"me"}})
+	if err != nil {
+		t.Fatalf("while reading and parsing fake .csv: %v", err)
+	}
+
+	expected := []time.Duration{10 * time.Second, 0}
+	for i, s := range sites {
+		if s.Timeout != expected[i] {
+			t.Fatalf("expected site %v to have a timeout of %v. got=%v", i, expected[i], s.Timeout)
+		}
+	}
+
+	for _, timeout := range []string{"soon", "-1s", "0s"} {
+		data = ".com,https://$.com,https://$.com/u,,,,,,,,," + timeout
+		if _, _, err := readAndParseCSV(csv.NewReader(strings.NewReader(data)), &parseOptions{users: []string{"me"}}); err == nil {
+			t.Fatalf("expected to fail with timeout %q", timeout)
+		}
+	}
+}
+
+func TestReadAndParseCSVNotFoundRedirect(t *testing.T) {
+	data := ".com,https://$.com,https://$.com/u,,,,,,,,,,,,,,,https://site.com/\n.org,https://$.org,https://$.org/u"
+	sites, _, err := readAndParseCSV(csv.NewReader(strings.NewReader(data)), &parseOptions{users: []string{"me"}})
+	if err != nil {
+		t.Fatalf("while reading and parsing fake .csv: %v", err)
+	}
+
+	if sites[0].NotFoundRedirect == nil || sites[0].NotFoundRedirect.Host != "site.com" {
+		t.Fatalf("expected first site to have a not found redirect to %q. got=%v", "site.com", sites[0].NotFoundRedirect)
+	}
+
+	if sites[1].NotFoundRedirect != nil {
+		t.Fatalf("expected second site to not have a not found redirect. got=%v", sites[1].NotFoundRedirect)
+	}
+
+	for _, target := range []string{"/login", "site.com", "http://[::1"} {
+		data = ".com,https://$.com,https://$.com/u,,,,,,,,,,,,,,," + target
+		if _, _, err := readAndParseCSV(csv.NewReader(strings.NewReader(data)), &parseOptions{users: []string{"me"}}); err == nil {
+			t.Fatalf("expected to fail with not found redirect %q", target)
+		}
+	}
+}
+
+func TestReadAndParseCSVMinSize(t *testing.T) {
+	data := ".com,https://$.com,https://$.com/u,,,,,,,,,,,,,,,,512\n.org,https://$.org,https://$.org/u"
+	sites, _, err := readAndParseCSV(csv.NewReader(strings.NewReader(data)), &parseOptions{users: []string{"me"}})
+	if err != nil {
+		t.Fatalf("while reading and parsing fake .csv: %v", err)
+	}
+
+	if sites[0].MinSize != 512 || sites[1].MinSize != 0 {
+		t.Fatalf("expected min sizes of 512 and 0. got=%v and %v", sites[0].MinSize, sites[1].MinSize)
+	}
+
+	for _, size := range []string{"-1", "big", "1-2"} {
+		data = ".com,https://$.com,https://$.com/u,,,,,,,,,,,,,,,," + size
+		if _, _, err := readAndParseCSV(csv.NewReader(strings.NewReader(data)), &parseOptions{users: []string{"me"}}); err == nil {
+			t.Fatalf("expected to fail with min size %q", size)
+		}
+	}
+}
+
+func TestReadAndParseCSVErrorStrings(t *testing.T) {
+	data := ".com,https://$.com,https://$.com/u,,,,,,,,,,,,,,,,,not found;no such user,all\n.org,https://$.org,https://$.org/u"
+	sites, _, err := readAndParseCSV(csv.NewReader(strings.NewReader(data)), &parseOptions{users: []string{"me"}})
+	if err != nil {
+		t.Fatalf("while reading and parsing fake .csv: %v", err)
+	}
+
+	expected := []string{"not found", "no such user"}
+	if !reflect.DeepEqual(sites[0].ErrorStrings, expected) || !sites[0].ErrorMatchAll {
+		t.Fatalf("expected first site to match all of %q. got=%q and all=%v", expected, sites[0].ErrorStrings, sites[0].ErrorMatchAll)
+	}
+
+	if len(sites[1].ErrorStrings) != 0 || sites[1].ErrorMatchAll {
+		t.Fatalf("expected second site to not have error strings. got=%q and all=%v", sites[1].ErrorStrings, sites[1].ErrorMatchAll)
+	}
+
+	data = ".com,https://$.com,https://$.com/u,,,,,,,,,,,,,,,,,not found,some"
+	if _, _, err := readAndParseCSV(csv.NewReader(strings.NewReader(data)), &parseOptions{users: []string{"me"}}); err == nil {
+		t.Fatalf("expected to fail with an invalid error mode")
+	}
+}
+
+func TestReadAndParseCSVDetector(t *testing.T) {
+	data := ".com,https://$.com,https://$.com/u,,,,,,,,,,,,,,,,,,,grep -q  profile\n.org,https://$.org,https://$.org/u"
+	sites, _, err := readAndParseCSV(csv.NewReader(strings.NewReader(data)), &parseOptions{users: []string{"me"}})
+	if err != nil {
+		t.Fatalf("while reading and parsing fake .csv: %v", err)
+	}
+
+	expected := []string{"grep", "-q", "profile"}
+	if !reflect.DeepEqual(sites[0].Detector, expected) {
+		t.Fatalf("expected first site to have detector %q. got=%q", expected, sites[0].Detector)
+	}
+
+	if len(sites[1].Detector) != 0 {
+		t.Fatalf("expected second site to not have a detector. got=%q", sites[1].Detector)
+	}
+}
+
+func TestReadAndParseCSVHeader(t *testing.T) {
+	tt := []struct {
+		name      string
+		data      string
+		hasHeader bool
+		expected  []string
+	}{
+		{"without header", ".com,https://$.com,https://$.com/u\n.org,https://$.org,https://$.org/u", false, []string{".com", ".org"}},
+		{"with header", "name,mainURL,userURL\n.com,https://$.com,https://$.com/u", false, []string{".com"}},
+		{"with uppercase header", "Name,Main URL,User URL,Status\n.com,https://$.com,https://$.com/u", false, []string{".com"}},
+		{"with site called name", "name,https://$.name,https://$.name/u\n.com,https://$.com,https://$.com/u", false, []string{"name", ".com"}},
+		{"forced header", "site,main,user\n.com,https://$.com,https://$.com/u", true, []string{".com"}},
+		{"forced header without header", ".com,https://$.com,https://$.com/u\n.org,https://$.org,https://$.org/u", true, []string{".org"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			sites, _, err := readAndParseCSV(csv.NewReader(strings.NewReader(tc.data)), &parseOptions{users: []string{"me"}, hasHeader: tc.hasHeader})
+			if err != nil {
+				t.Fatalf("while reading and parsing fake .csv: %v", err)
+			}
+
+			var names []string
+			for _, s := range sites {
+				names = append(names, s.Name)
+			}
+
+			if !reflect.DeepEqual(names, tc.expected) {
+				t.Fatalf("expected sites %q. got=%q", tc.expected, names)
+			}
+		})
+	}
+}
+
+func TestCSVOptions(t *testing.T) {
+	tt := []struct {
+		name      string
+		delimiter string
+		comment   string
+		expected  *parseOptions
+		fail      bool
+	}{
+		{name: "defaults", delimiter: ",", expected: &parseOptions{delimiter: ','}},
+		{name: "tab and comment", delimiter: `\t`, comment: "#", expected: &parseOptions{delimiter: '\t', comment: '#'}},
+		{name: "empty delimiter", delimiter: "", fail: true},
+		{name: "long delimiter", delimiter: ";;", fail: true},
+		{name: "long comment", delimiter: ",", comment: "//", fail: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := csvOptions(tc.delimiter, tc.comment)
+			if (err != nil) != tc.fail {
+				t.Fatalf("expected to fail: %v. got err=%v", tc.fail, err)
+			}
+
+			if !reflect.DeepEqual(opts, tc.expected) {
+				t.Fatalf("expected %+v. got=%+v", tc.expected, opts)
+			}
+		})
+	}
+}
+
+func TestParseCredentials(t *testing.T) {
+	tt := []struct {
+		name     string
+		s        string
+		expected *scan.Credentials
+		fail     bool
+	}{
+		{name: "empty", s: ""},
+		{name: "valid", s: "me:secret", expected: &scan.Credentials{Username: "me", Password: "secret"}},
+		{name: "colon in password", s: "me:se:cret", expected: &scan.Credentials{Username: "me", Password: "se:cret"}},
+		{name: "empty password", s: "me:", expected: &scan.Credentials{Username: "me"}},
+		{name: "without password", s: "me", fail: true},
+		{name: "without username", s: ":secret", fail: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := parseCredentials(tc.s)
+			if tc.fail {
+				if err == nil {
+					t.Fatalf("expected to fail with %q", tc.s)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+
+			if !reflect.DeepEqual(c, tc.expected) {
+				t.Fatalf("expected %+v as credentials. got=%+v", tc.expected, c)
+			}
+		})
+	}
+}
+
+func TestParseSitesDelimiterAndComment(t *testing.T) {
+	data := "# sites\n.com;https://$.com;https://$.com/u\n#.org;https://$.org;https://$.org/u\n.net;https://$.net;https://$.net/u"
+	opts := &parseOptions{users: []string{"me"}, delimiter: ';', comment: '#'}
+	sites, _, err := parseSites(strings.NewReader(data), "csv", opts)
+	if err != nil {
+		t.Fatalf("while parsing fake .csv: %v", err)
+	}
+
+	expected := []string{"https://me.com/u", "https://me.net/u"}
+	if len(sites) != len(expected) {
+		t.Fatalf("expected sites to have a length of %v. got=%v", len(expected), len(sites))
+	}
+
+	for i, s := range sites {
+		if s.UserURL != expected[i] {
+			t.Fatalf("expected site %v to have %q as userURL. got=%q", i, expected[i], s.UserURL)
+		}
+	}
+}
+
+func TestParseRune(t *testing.T) {
+	tt := []struct {
+		name     string
+		s        string
+		expected rune
+		fail     bool
+	}{
+		{name: "empty", s: "", expected: 0},
+		{name: "semicolon", s: ";", expected: ';'},
+		{name: "tab", s: `\t`, expected: '\t'},
+		{name: "multibyte", s: "¦", expected: '¦'},
+		{name: "several characters", s: ";;", fail: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := parseRune(tc.s)
+			if tc.fail {
+				if err == nil {
+					t.Fatalf("expected to fail with %q", tc.s)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+
+			if r != tc.expected {
+				t.Fatalf("expected %q as rune. got=%q", tc.expected, r)
+			}
+		})
+	}
+}
+
+func TestReadAndParseCSVMethodAndBody(t *testing.T) {
+	data := `api,https://$.com,https://api.com/check,,,,,,,,,,,post,"{""username"": ""$""}"`
+	sites, _, err := readAndParseCSV(csv.NewReader(strings.NewReader(data)), &parseOptions{users: []string{"me"}})
+	if err != nil {
+		t.Fatalf("while reading and parsing fake .csv: %v", err)
+	}
+
+	if sites[0].Method != http.MethodPost {
+		t.Fatalf("expected %q as method. got=%q", http.MethodPost, sites[0].Method)
+	}
+
+	expected := `{"username": "me"}`
+	if sites[0].Body != expected {
+		t.Fatalf("expected %q as body. got=%q", expected, sites[0].Body)
+	}
+}
+
+func TestParseMatcher(t *testing.T) {
+	tt := []struct {
+		name     string
+		s        string
+		expected scan.Matcher
+		fail     bool
+	}{
+		{name: "empty", s: ""},
+		{name: "regexp", s: "re:^ok$", expected: &scan.RegexpMatcher{Regexp: regexp.MustCompile("^ok$")}},
+		{name: "json path", s: "json:data.exists", expected: &scan.JSONMatcher{Path: []string{"data", "exists"}}},
+		{name: "json value", s: "json:status=a=b", expected: &scan.JSONMatcher{Path: []string{"status"}, Value: "a=b"}},
+		{name: "invalid regexp", s: "re:(", fail: true},
+		{name: "empty key", s: "json:data..exists", fail: true},
+		{name: "unknown kind", s: "xpath://user", fail: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := parseMatcher(tc.s)
+			if tc.fail {
+				if err == nil {
+					t.Fatalf("expected to fail with %q", tc.s)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+
+			if !reflect.DeepEqual(m, tc.expected) {
+				t.Fatalf("expected %#v as matcher. got=%#v", tc.expected, m)
+			}
+		})
+	}
+}
+
+func TestParseHeaderMatcher(t *testing.T) {
+	tt := []struct {
+		name     string
+		s        string
+		expected *scan.HeaderMatcher
+		fail     bool
+	}{
+		{name: "empty", s: ""},
+		{name: "presence", s: "Set-Cookie", expected: &scan.HeaderMatcher{Name: "Set-Cookie"}},
+		{name: "pattern", s: "Location:^https?://", expected: &scan.HeaderMatcher{Name: "Location", Pattern: regexp.MustCompile("^https?://")}},
+		{name: "empty name", s: ":abc", fail: true},
+		{name: "invalid pattern", s: "Location:(", fail: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := parseHeaderMatcher(tc.s)
+			if tc.fail {
+				if err == nil {
+					t.Fatalf("expected to fail with %q", tc.s)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+
+			if !reflect.DeepEqual(m, tc.expected) {
+				t.Fatalf("expected %#v as header matcher. got=%#v", tc.expected, m)
+			}
+		})
+	}
+}
+
+func TestReadAndParseCSVMultipleUsers(t *testing.T) {
+	r := csv.NewReader(strings.NewReader(".com,https://$.com,https://$.com/u\n.org,https://$.org,https://$.org/u"))
+	sites, _, err := readAndParseCSV(r, &parseOptions{users: []string{"me", "you"}})
+	if err != nil {
+		t.Fatalf("while reading and parsing fake .csv: %v", err)
+	}
+
+	expected := []string{"https://me.com/u", "https://you.com/u", "https://me.org/u", "https://you.org/u"}
+	if len(sites) != len(expected) {
+		t.Fatalf("expected sites to have a length of %v. got=%v", len(expected), len(sites))
+	}
+
+	for i, s := range sites {
+		if s.UserURL != expected[i] {
+			t.Fatalf("expected site %v to have %q as userURL. got=%q", i, expected[i], s.UserURL)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	def := &definition{site: &scan.Site{
+		MainURL: "https://example.com",
+		UserURL: "https://example.com/$",
+		Body:    "user=$",
+	}}
+
+	tt := []struct {
+		name        string
+		urlEncode   bool
+		expectedURL string
+		expected    string
+	}{
+		{name: "plain", expectedURL: "https://example.com/me & you", expected: "user=me & you"},
+		{name: "url encoded", urlEncode: true, expectedURL: "https://example.com/me%20&%20you", expected: "user=me+%26+you"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			sites := expand(nil, def, &parseOptions{users: []string{"me & you"}, urlEncode: tc.urlEncode})
+			if len(sites) != 1 {
+				t.Fatalf("expected 1 site. got=%v", len(sites))
+			}
+
+			if sites[0].UserURL != tc.expectedURL {
+				t.Fatalf("expected %q as userURL. got=%q", tc.expectedURL, sites[0].UserURL)
+			}
+
+			if sites[0].Body != tc.expected {
+				t.Fatalf("expected %q as body. got=%q", tc.expected, sites[0].Body)
+			}
+		})
+	}
+}
+
+func TestFilterSites(t *testing.T) {
+	sites := []*scan.Site{{Name: "GitHub"}, {Name: "GitLab"}, {Name: "Twitter"}, {Name: "Reddit"}}
+
+	tt := []struct {
+		name     string
+		only     []string
+		exclude  []string
+		expected string
+	}{
+		{
+			name:     "no filters",
+			expected: "GitHub GitLab Twitter Reddit",
+		},
+		{
+			name:     "only",
+			only:     []string{"github", " TWITTER"},
+			expected: "GitHub Twitter",
+		},
+		{
+			name:     "exclude",
+			exclude:  []string{"reddit"},
+			expected: "GitHub GitLab Twitter",
+		},
+		{
+			name:     "only and exclude",
+			only:     []string{"github", "gitlab"},
+			exclude:  []string{"gitlab"},
+			expected: "GitHub",
+		},
+		{
+			name:     "no matches",
+			only:     []string{"facebook"},
+			expected: "",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var names []string
+			for _, s := range filterSites(sites, tc.only, tc.exclude) {
+				names = append(names, s.Name)
+			}
+
+			if got := strings.Join(names, " "); got != tc.expected {
+				t.Fatalf("expected %q as sites. got=%q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestFilterDomains(t *testing.T) {
+	sites := []*scan.Site{
+		{Name: "GitHub", MainURL: "https://github.com/me"},
+		{Name: "Gist", MainURL: "https://gist.GitHub.com:443/me"},
+		{Name: "NotGitHub", MainURL: "https://notgithub.com/me"},
+		{Name: "Reddit", MainURL: "https://reddit.com/user/me"},
+		{Name: "BBC", MainURL: "https://bbc.co.uk/me"},
+	}
+
+	tt := []struct {
+		name     string
+		domains  []string
+		expected string
+	}{
+		{
+			name:     "domain and subdomains",
+			domains:  []string{"github.com"},
+			expected: "GitHub Gist",
+		},
+		{
+			name:     "subdomain",
+			domains:  []string{" GIST.github.com"},
+			expected: "Gist",
+		},
+		{
+			name:     "tld",
+			domains:  []string{".uk", "reddit.com"},
+			expected: "Reddit BBC",
+		},
+		{
+			name:     "no matches",
+			domains:  []string{"hub.com"},
+			expected: "",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var names []string
+			for _, s := range filterDomains(sites, tc.domains) {
+				names = append(names, s.Name)
+			}
+
+			if got := strings.Join(names, " "); got != tc.expected {
+				t.Fatalf("expected %q as sites. got=%q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	sites := []*scan.Site{
+		{Name: "a", User: "me", MainURL: "https://me.com", UserURL: "https://me.com/u"},
+		{Name: "b", User: "me", MainURL: "https://me.com", UserURL: "https://me.com/u"},
+		{Name: "c", User: "you", MainURL: "https://me.com", UserURL: "https://me.com/u"},
+		{Name: "d", User: "me", MainURL: "https://me.com", UserURL: "https://me.com/profile"},
+	}
+
+	unique, removed := dedupe(sites)
+	if removed != 1 {
+		t.Fatalf("expected %v removed sites. got=%v", 1, removed)
+	}
+
+	var names string
+	for _, s := range unique {
+		names += s.Name
+	}
+
+	if names != "acd" {
+		t.Fatalf("expected %q as remaining sites. got=%q", "acd", names)
+	}
+}
+
+func TestReplaceURL(t *testing.T) {
+	tt := []struct {
+		old         string
+		placeholder string
+		new         string
+		expected    string
+	}{
+		{
+			old:         "$",
+			placeholder: "$",
+			new:         "me",
+			expected:    "me",
+		},
+		{
+			old:         "$$$y",
+			placeholder: "$",
+			new:         "me",
+			expected:    "mememey",
+		},
+		{
+			old:         "https://$.com",
+			placeholder: "$",
+			new:         "me",
+			expected:    "https://me.com",
+		},
+		{
+			old:         "https://site.com/{}?q=$",
+			placeholder: "{}",
+			new:         "me",
+			expected:    "https://site.com/me?q=$",
+		},
+		{
+			old:         "https://site.com/$?user=$",
+			placeholder: "$",
+			new:         "me",
+			expected:    "https://site.com/me?user=me",
+		},
+		{
+			old:         "https://{username}.com/{username}",
+			placeholder: "{username}",
+			new:         "me",
+			expected:    "https://me.com/me",
+		},
+		{
+			old:         "",
+			placeholder: "$",
+			new:         "",
+			expected:    "",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.expected, func(t *testing.T) {
+			url := replaceURL(tc.old, tc.placeholder, tc.new)
+			if url != tc.expected {
+				t.Fatalf("expected %q as result. got=%q", tc.expected, url)
+			}
+		})
+	}
+}
+
+func TestReplaceEncodedURL(t *testing.T) {
+	tt := []struct {
+		name     string
+		old      string
+		new      string
+		expected string
+	}{
+		{
+			name:     "path with spaces",
+			old:      "https://site.com/user/$",
+			new:      "john doe",
+			expected: "https://site.com/user/john%20doe",
+		},
+		{
+			name:     "query with spaces",
+			old:      "https://site.com/search?q=$&type=user",
+			new:      "john doe#1",
+			expected: "https://site.com/search?q=john+doe%231&type=user",
+		},
+		{
+			name:     "path and query",
+			old:      "https://site.com/$?user=$",
+			new:      "a/b&c",
+			expected: "https://site.com/a%2Fb&c?user=a%2Fb%26c",
+		},
+		{
+			name:     "unicode",
+			old:      "https://site.com/@$",
+			new:      "josé",
+			expected: "https://site.com/@jos%C3%A9",
+		},
+		{
+			name:     "host",
+			old:      "https://$.site.com/$",
+			new:      "me",
+			expected: "https://me.site.com/me",
+		},
+		{
+			name:     "no placeholder",
+			old:      "https://site.com",
+			new:      "john doe",
+			expected: "https://site.com",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			url := replaceEncodedURL(tc.old, "$", tc.new)
+			if url != tc.expected {
+				t.Fatalf("expected %q as result. got=%q", tc.expected, url)
+			}
+		})
+	}
+}
+
+func TestNeedsEncoding(t *testing.T) {
+	for user, expected := range map[string]bool{"me": false, "me_2.0": false, "john doe": true, "me#1": true, "josé": true} {
+		if needsEncoding(user) != expected {
+			t.Fatalf("expected username %q to need encoding=%v", user, expected)
+		}
+	}
+}
+
+func TestShuffleSites(t *testing.T) {
+	newSites := func() []*scan.Site {
+		var sites []*scan.Site
+		for i := 0; i < 20; i++ {
+			sites = append(sites, &scan.Site{Name: strconv.Itoa(i)})
+		}
+		return sites
+	}
+
+	names := func(sites []*scan.Site) string {
+		var n []string
+		for _, s := range sites {
+			n = append(n, s.Name)
+		}
+		return strings.Join(n, ",")
+	}
+
+	original := names(newSites())
+
+	a, b := newSites(), newSites()
+	shuffleSites(a, 42)
+	shuffleSites(b, 42)
+	if names(a) != names(b) {
+		t.Fatalf("expected the same seed to produce the same order. got=%q and %q", names(a), names(b))
+	}
+
+	if names(a) == original {
+		t.Fatalf("expected the order of the sites to change. got=%q", names(a))
+	}
+
+	if len(a) != 20 {
+		t.Fatalf("expected shuffled sites to have a length of %v. got=%v", 20, len(a))
+	}
+}
+
+func BenchmarkReadAndParseCSV(b *testing.B) {
+	tt := []struct {
+		lines int
+		users int
+	}{
+		{lines: 1000, users: 1},
+		{lines: 10000, users: 1},
+		{lines: 50000, users: 1},
+		{lines: 5000, users: 10},
+	}
+
+	for _, tc := range tt {
+		var data strings.Builder
+		for i := 0; i < tc.lines; i++ {
+			fmt.Fprintf(&data, "site%d,https://site%d.com/$,https://site%d.com/api/$,Not Found,Accept:text/html,200;301\n", i, i, i)
+		}
+
+		var users []string
+		for i := 0; i < tc.users; i++ {
+			users = append(users, fmt.Sprintf("user%d", i))
+		}
+
+		b.Run(fmt.Sprintf("%d lines %d users", tc.lines, tc.users), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				sites, _, err := parseSites(strings.NewReader(data.String()), "csv", &parseOptions{users: users})
+				if err != nil {
+					b.Fatalf("not expected to fail: %v", err)
+				}
+
+				if len(sites) != tc.lines*tc.users {
+					b.Fatalf("expected %v sites. got=%v", tc.lines*tc.users, len(sites))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/danielkvist/beagle/client"
+	"github.com/danielkvist/beagle/scan"
+
+	"github.com/spf13/cobra"
+)
+
+// Health states of a site definition.
+const (
+	healthOK       = "OK"
+	healthDead     = "DEAD"
+	healthRedirect = "REDIRECT"
+	healthChanged  = "CHANGED"
+)
+
+// validateCommand returns the command that checks that the
+// sites of a file still work by requesting their mainURL
+// with a username that is known to exist on them.
+func validateCommand() *cobra.Command {
+	var (
+		agent      string
+		comment    string
+		delimiter  string
+		files      []string
+		format     string
+		goroutines int
+		hasHeader  bool
+		insecure   bool
+		proxy      string
+		timeout    time.Duration
+		user       string
+	)
+
+	validate := &cobra.Command{
+		Use:   "validate",
+		Short: "Checks that the sites of a file still work",
+		Long: "Validate requests the mainURL of every site of a file, with a username that exists on all of them, " +
+			"and reports the sites that are dead, that redirect or whose status code does not find the username anymore.",
+		Example: "beagle validate -f urls.csv -u torvalds -g 10",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := setFlagsFromEnv(cmd.Flags(), os.LookupEnv); err != nil {
+				return err
+			}
+
+			if user == "" {
+				return fmt.Errorf("a username that exists on the sites is required")
+			}
+
+			c, err := client.New(
+				client.WithTimeout(timeout),
+				client.WithProxy(proxy),
+				client.WithFollowRedirects(false),
+				client.WithInsecureSkipVerify(insecure),
+			)
+			if err != nil {
+				return err
+			}
+
+			parseOpts, err := csvOptions(delimiter, comment)
+			if err != nil {
+				return err
+			}
+
+			parseOpts.users = []string{user}
+			parseOpts.hasHeader = hasHeader
+			sites, err := readFiles(c, files, format, parseOpts)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := interruptContext(context.Background())
+			defer cancel()
+
+			results, err := scan.Search(ctx, mainSites(sites), scan.Options{
+				Client:     c,
+				Agents:     []string{agent},
+				Goroutines: goroutines,
+			})
+			if err != nil {
+				return fmt.Errorf("while validating: %v", err)
+			}
+
+			sortResults(results)
+			broken, err := printHealth(os.Stdout, results)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(os.Stderr, "%d sites validated: %d healthy, %d broken\n", len(results), len(results)-broken, broken)
+			if broken > 0 {
+				return &ExitError{Code: ExitNotFound, Reason: fmt.Sprintf("%d sites are broken", broken)}
+			}
+
+			return nil
+		},
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+
+	validate.Flags().StringVarP(&agent, "agent", "a", "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:67.0) Gecko/20100101 Firefox/67.0", "user agent")
+	validate.Flags().StringVar(&comment, "comment", "", "character that starts the comment lines of a .csv file")
+	validate.Flags().StringVar(&delimiter, "delimiter", ",", "character that separates the fields of a .csv file, \\t for tabs")
+	validate.Flags().StringArrayVarP(&files, "file", "f", []string{"./urls.csv"}, ".csv or .json file with the URLs to validate, can be a path, an http(s) URL or - to read it from stdin, can be repeated")
+	validate.Flags().StringVar(&format, "format", "", "format of the file with the URLs (csv or json), detected from its extension if empty")
+	validate.Flags().BoolVar(&hasHeader, "has-header", false, "skips the first line of the .csv files, which is skipped anyway if it looks like a header")
+	validate.Flags().IntVarP(&goroutines, "goroutines", "g", 1, "number of goroutines")
+	validate.Flags().BoolVar(&insecure, "insecure", false, "does not verify the TLS certificates of the sites")
+	validate.Flags().StringVarP(&proxy, "proxy", "p", "", "proxy URL, like http://localhost:8080 or socks5://localhost:9050 for Tor")
+	validate.Flags().DurationVarP(&timeout, "timeout", "t", 3*time.Second, "max time to wait for a response from a site")
+	validate.Flags().StringVarP(&user, "user", "u", "", "username that exists on all the sites")
+
+	return validate
+}
+
+// mainSites returns a copy of each one of sites that
+// requests its mainURL instead of its userURL. Invert is
+// not copied, since the username exists on the sites.
+func mainSites(sites []*scan.Site) []*scan.Site {
+	main := make([]*scan.Site, 0, len(sites))
+	for _, s := range sites {
+		main = append(main, &scan.Site{
+			Name:        s.Name,
+			MainURL:     s.MainURL,
+			UserURL:     s.MainURL,
+			User:        s.User,
+			Headers:     s.Headers,
+			FoundStatus: s.FoundStatus,
+			Cookies:     s.Cookies,
+			Timeout:     s.Timeout,
+			BasicAuth:   s.BasicAuth,
+		})
+	}
+
+	return main
+}
+
+// health returns the health state of the site of r.
+func health(r *scan.Result) string {
+	switch {
+	case r.Error != "":
+		return healthDead
+	case r.Found:
+		return healthOK
+	case r.StatusCode >= http.StatusMultipleChoices && r.StatusCode < http.StatusBadRequest:
+		return healthRedirect
+	default:
+		return healthChanged
+	}
+}
+
+// printHealth prints the health state of the site of each one
+// of results that is not healthy and returns how many they are.
+func printHealth(w io.Writer, results []*scan.Result) (int, error) {
+	var broken int
+	for _, r := range results {
+		h := health(r)
+		if h == healthOK {
+			continue
+		}
+		broken++
+
+		detail := fmt.Sprintf("(%d)", r.StatusCode)
+		if h == healthDead {
+			detail = r.Error
+		}
+
+		if _, err := fmt.Fprintf(w, "%-8s %s %s %s\n", h, r.Name, r.MainURL, detail); err != nil {
+			return broken, err
+		}
+	}
+
+	return broken, nil
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danielkvist/beagle/scan"
+)
+
+func TestHealth(t *testing.T) {
+	tt := []struct {
+		name     string
+		r        *scan.Result
+		expected string
+	}{
+		{name: "ok", r: &scan.Result{StatusCode: 200, Found: true}, expected: healthOK},
+		{name: "dead", r: &scan.Result{Error: "no such host"}, expected: healthDead},
+		{name: "redirect", r: &scan.Result{StatusCode: 301}, expected: healthRedirect},
+		{name: "found redirect", r: &scan.Result{StatusCode: 302, Found: true}, expected: healthOK},
+		{name: "changed", r: &scan.Result{StatusCode: 404}, expected: healthChanged},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if h := health(tc.r); h != tc.expected {
+				t.Fatalf("expected %q as health. got=%q", tc.expected, h)
+			}
+		})
+	}
+}
+
+func TestPrintHealth(t *testing.T) {
+	results := []*scan.Result{
+		{Name: "github", MainURL: "https://github.com/me", StatusCode: 200, Found: true},
+		{Name: "gitlab", MainURL: "https://gitlab.com/me", StatusCode: 302},
+		{Name: "dead", MainURL: "https://dead.com/me", Error: "no such host"},
+	}
+
+	var b strings.Builder
+	broken, err := printHealth(&b, results)
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	if broken != 2 {
+		t.Fatalf("expected %v broken sites. got=%v", 2, broken)
+	}
+
+	expected := "REDIRECT gitlab https://gitlab.com/me (302)\nDEAD     dead https://dead.com/me no such host\n"
+	if b.String() != expected {
+		t.Fatalf("expected %q. got=%q", expected, b.String())
+	}
+}
+
+func TestValidateCommand(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved/me":
+			http.Redirect(w, r, "/me", http.StatusMovedPermanently)
+		case "/redirect/me":
+			http.Redirect(w, r, "/me", http.StatusFound)
+		}
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "beagle")
+	if err != nil {
+		t.Fatalf("while creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "urls.csv")
+	healthy := "ok," + ts.URL + "/$," + ts.URL + "/x/$\n" +
+		"inverted," + ts.URL + "/$," + ts.URL + "/x/$,,,,true\n" +
+		"redirect," + ts.URL + "/redirect/$," + ts.URL + "/x/$,,,302\n"
+	if err := ioutil.WriteFile(path, []byte(healthy), 0644); err != nil {
+		t.Fatalf("while writing file: %v", err)
+	}
+
+	validate := validateCommand()
+	validate.SetArgs([]string{"-f", path, "-u", "me"})
+	if err := validate.Execute(); err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	broken := healthy + "moved," + ts.URL + "/moved/$," + ts.URL + "/moved/$\n"
+	if err := ioutil.WriteFile(path, []byte(broken), 0644); err != nil {
+		t.Fatalf("while writing file: %v", err)
+	}
+
+	validate = validateCommand()
+	validate.SetArgs([]string{"-f", path, "-u", "me"})
+	err = validate.Execute()
+
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != ExitNotFound {
+		t.Fatalf("expected to fail with exit code %v. got=%v", ExitNotFound, err)
+	}
+}
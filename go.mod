@@ -1,5 +1,9 @@
 module github.com/danielkvist/beagle
 
-go 1.12
+go 1.13
 
-require github.com/spf13/cobra v0.0.5
+require (
+	github.com/spf13/cobra v0.0.5
+	github.com/spf13/pflag v1.0.3
+	golang.org/x/net v0.0.0-20191209160850-c0dbc17a3553
+)
@@ -1,14 +1,26 @@
 package main
 
 import (
+	"errors"
 	"log"
+	"os"
 
 	"github.com/danielkvist/beagle/cmd"
 )
 
+// exitFailure is the exit code used when
+// the root command fails to run.
+const exitFailure = 3
+
 func main() {
 	root := cmd.Root()
 	if err := root.Execute(); err != nil {
-		log.Fatalf("error while executing the root command: %v", err)
+		var exitErr *cmd.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
+
+		log.Printf("error while executing the root command: %v", err)
+		os.Exit(exitFailure)
 	}
 }
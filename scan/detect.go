@@ -0,0 +1,74 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runDetector runs the Detector of site with the body of resp on
+// its standard input and the details of the check in environment
+// variables, and reports whether it finds the username: exit code
+// 0 means found and 1 not found. Any other one is an error. It is
+// killed after timeout if it is greater than 0.
+func runDetector(ctx context.Context, site *Site, resp response, timeout time.Duration) (bool, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, site.Detector[0], site.Detector[1:]...)
+	cmd.Stdin = strings.NewReader(resp.body)
+	cmd.Env = append(os.Environ(), detectorEnv(site, resp)...)
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		return false, nil
+	default:
+		return false, fmt.Errorf("while running detector %q: %v", site.Detector[0], err)
+	}
+}
+
+// detectorTimeout returns the max time that the Detector of site
+// can run, which is the one that a request made to site gets: its
+// Timeout or the one of c, capped by opts.RequestTimeout.
+func detectorTimeout(site *Site, c *http.Client, opts *Options) time.Duration {
+	timeout := c.Timeout
+	if site.Timeout > 0 {
+		timeout = site.Timeout
+	}
+
+	if opts.RequestTimeout > 0 && (timeout <= 0 || opts.RequestTimeout < timeout) {
+		timeout = opts.RequestTimeout
+	}
+
+	return timeout
+}
+
+// detectorEnv returns the environment variables
+// with which the Detector of site is run.
+func detectorEnv(site *Site, resp response) []string {
+	finalURL := site.UserURL
+	if resp.url != nil {
+		finalURL = resp.url.String()
+	}
+
+	return []string{
+		"BEAGLE_SITE=" + site.Name,
+		"BEAGLE_USER=" + site.User,
+		"BEAGLE_USER_URL=" + site.UserURL,
+		"BEAGLE_URL=" + finalURL,
+		"BEAGLE_STATUS=" + strconv.Itoa(resp.statusCode),
+	}
+}
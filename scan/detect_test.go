@@ -0,0 +1,124 @@
+package scan
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSearchDetector(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		w.Write([]byte("the profile of the user"))
+	}))
+	defer ts.Close()
+
+	tt := []struct {
+		name     string
+		site     *Site
+		expected bool
+		fail     bool
+	}{
+		{name: "body matches", site: &Site{UserURL: ts.URL + "/me", Detector: []string{"grep", "-q", "profile"}}, expected: true},
+		{name: "body does not match", site: &Site{UserURL: ts.URL + "/me", Detector: []string{"grep", "-q", "nothing"}}, expected: false},
+		{name: "overrides the status", site: &Site{UserURL: ts.URL + "/missing", Detector: []string{"grep", "-q", "profile"}}, expected: true},
+		{name: "environment", site: &Site{Name: "site", User: "me", UserURL: ts.URL + "/missing", Detector: []string{"sh", "-c", `test "$BEAGLE_STATUS" = 404 && test "$BEAGLE_SITE" = site && test "$BEAGLE_USER" = me`}}, expected: true},
+		{name: "other exit code", site: &Site{UserURL: ts.URL + "/me", Detector: []string{"sh", "-c", "exit 2"}}, fail: true},
+		{name: "missing command", site: &Site{UserURL: ts.URL + "/me", Detector: []string{"beagle-detector-that-does-not-exist"}}, fail: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			results, err := Search(context.Background(), []*Site{tc.site}, Options{AllowExec: true})
+			if err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+
+			r := results[0]
+			if tc.fail {
+				if r.Error == "" || r.Found {
+					t.Fatalf("expected the detector to fail. got found=%v and error %q", r.Found, r.Error)
+				}
+				return
+			}
+
+			if r.Error != "" {
+				t.Fatalf("not expected to fail: %v", r.Error)
+			}
+
+			if r.Found != tc.expected {
+				t.Fatalf("expected found=%v. got=%v", tc.expected, r.Found)
+			}
+		})
+	}
+}
+
+func TestSearchDetectorNotAllowed(t *testing.T) {
+	sites := []*Site{{Name: "site", UserURL: "http://127.0.0.1:1/me", Detector: []string{"true"}}}
+	if _, err := Search(context.Background(), sites, Options{}); err == nil {
+		t.Fatalf("expected to fail without AllowExec")
+	}
+}
+
+func TestSearchDetectorTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	sleep := []string{"sleep", "5"}
+	tt := []struct {
+		name string
+		site *Site
+		opts Options
+	}{
+		{name: "site timeout", site: &Site{UserURL: ts.URL, Timeout: 100 * time.Millisecond, Detector: sleep}},
+		{name: "client timeout", site: &Site{UserURL: ts.URL, Detector: sleep}, opts: Options{Client: &http.Client{Timeout: 100 * time.Millisecond}}},
+		{name: "request timeout", site: &Site{UserURL: ts.URL, Timeout: time.Minute, Detector: sleep}, opts: Options{RequestTimeout: 100 * time.Millisecond}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opts.AllowExec = true
+			start := time.Now()
+			results, err := Search(context.Background(), []*Site{tc.site}, tc.opts)
+			if err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+
+			if results[0].Error == "" {
+				t.Fatalf("expected the detector to be killed")
+			}
+
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Fatalf("expected the detector to be killed after its timeout. got=%v", elapsed)
+			}
+		})
+	}
+}
+
+func TestDetectorTimeout(t *testing.T) {
+	tt := []struct {
+		name     string
+		site     *Site
+		c        *http.Client
+		opts     *Options
+		expected time.Duration
+	}{
+		{name: "none", site: &Site{}, c: &http.Client{}, opts: &Options{}, expected: 0},
+		{name: "client", site: &Site{}, c: &http.Client{Timeout: 3 * time.Second}, opts: &Options{}, expected: 3 * time.Second},
+		{name: "site", site: &Site{Timeout: time.Second}, c: &http.Client{Timeout: 3 * time.Second}, opts: &Options{}, expected: time.Second},
+		{name: "capped by request timeout", site: &Site{Timeout: time.Minute}, c: &http.Client{}, opts: &Options{RequestTimeout: 2 * time.Second}, expected: 2 * time.Second},
+		{name: "request timeout only", site: &Site{}, c: &http.Client{}, opts: &Options{RequestTimeout: 2 * time.Second}, expected: 2 * time.Second},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if d := detectorTimeout(tc.site, tc.c, tc.opts); d != tc.expected {
+				t.Fatalf("expected %v. got=%v", tc.expected, d)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package scan
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// hostLimiter limits the number of sites with
+// the same host that are checked at the same time.
+type hostLimiter struct {
+	n     int
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+// newHostLimiter returns a hostLimiter that allows n sites per
+// host, or nil, which does not limit them, if n is lower than 1.
+func newHostLimiter(n int) *hostLimiter {
+	if n < 1 {
+		return nil
+	}
+
+	return &hostLimiter{n: n, slots: map[string]chan struct{}{}}
+}
+
+// acquire waits until site can be checked without exceeding the
+// limit of its host and returns a function to release it, or the
+// error of ctx if it is done before. The worker that calls it
+// waits too, so the workers that get sites of a busy host do not
+// check the sites of the other hosts meanwhile.
+func (l *hostLimiter) acquire(ctx context.Context, site *Site) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	host := siteHost(site)
+	l.mu.Lock()
+	slots, ok := l.slots[host]
+	if !ok {
+		slots = make(chan struct{}, l.n)
+		l.slots[host] = slots
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	}
+}
+
+// siteHost returns the host of the MainURL of site, or of its
+// UserURL if it has none, so the sites whose profiles are served
+// from a shared domain, like a CDN, are not limited together.
+func siteHost(site *Site) string {
+	raw := site.MainURL
+	if raw == "" {
+		raw = site.UserURL
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+
+	return strings.ToLower(u.Host)
+}
@@ -0,0 +1,101 @@
+package scan
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// concurrencyServer returns a server that records the max
+// number of requests that it has handled at the same time.
+func concurrencyServer(mu *sync.Mutex, max *int) *httptest.Server {
+	var current int
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		current++
+		if current > *max {
+			*max = current
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		current--
+		mu.Unlock()
+	}))
+}
+
+func TestSearchMaxPerHost(t *testing.T) {
+	var mu sync.Mutex
+	var maxA, maxB int
+	a := concurrencyServer(&mu, &maxA)
+	defer a.Close()
+	b := concurrencyServer(&mu, &maxB)
+	defer b.Close()
+
+	var sites []*Site
+	for i := 0; i < 8; i++ {
+		sites = append(sites, &Site{UserURL: a.URL + "/me"}, &Site{UserURL: b.URL + "/me"})
+	}
+
+	results, err := Search(context.Background(), sites, Options{Goroutines: 16, MaxPerHost: 2})
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	for _, r := range results {
+		if !r.Found {
+			t.Fatalf("expected every site to be found. got=%+v", r)
+		}
+	}
+
+	if maxA != 2 || maxB != 2 {
+		t.Fatalf("expected 2 concurrent requests per host. got=%v and %v", maxA, maxB)
+	}
+}
+
+func TestHostLimiterCanceled(t *testing.T) {
+	l := newHostLimiter(1)
+	site := &Site{UserURL: "https://github.com/me"}
+
+	release, err := l.acquire(context.Background(), site)
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := l.acquire(ctx, &Site{UserURL: "https://GitHub.com/you"}); err != context.DeadlineExceeded {
+		t.Fatalf("expected to wait for the host until ctx is done. got=%v", err)
+	}
+
+	if _, err := l.acquire(context.Background(), &Site{UserURL: "https://gitlab.com/me"}); err != nil {
+		t.Fatalf("expected other hosts to not wait: %v", err)
+	}
+}
+
+func TestSiteHost(t *testing.T) {
+	tt := []struct {
+		name     string
+		site     *Site
+		expected string
+	}{
+		{name: "main url", site: &Site{MainURL: "https://Example.com/me", UserURL: "https://cdn.net/example/me"}, expected: "example.com"},
+		{name: "without main url", site: &Site{UserURL: "https://cdn.net:8080/example/me"}, expected: "cdn.net:8080"},
+		{name: "invalid url", site: &Site{MainURL: "http://[::1"}, expected: "http://[::1"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if host := siteHost(tc.site); host != tc.expected {
+				t.Fatalf("expected %q as host. got=%q", tc.expected, host)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package scan
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Matcher reports whether the body of a response
+// signals that a username exists on a site.
+type Matcher interface {
+	Match(body string) bool
+}
+
+// HeaderMatcher matches the responses that
+// have a header, like Location or Set-Cookie.
+type HeaderMatcher struct {
+	// Name is the name of the header.
+	Name string
+	// Pattern, if not nil, must match one of the
+	// values of the header. Otherwise the header
+	// only has to be present.
+	Pattern *regexp.Regexp
+}
+
+// Match reports whether header matches m.
+func (m *HeaderMatcher) Match(header http.Header) bool {
+	values := header[textproto.CanonicalMIMEHeaderKey(m.Name)]
+	if m.Pattern == nil {
+		return len(values) > 0
+	}
+
+	for _, v := range values {
+		if m.Pattern.MatchString(v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RegexpMatcher matches the bodies that match its Regexp.
+type RegexpMatcher struct {
+	Regexp *regexp.Regexp
+}
+
+// Match implements Matcher.
+func (m *RegexpMatcher) Match(body string) bool {
+	return m.Regexp.MatchString(body)
+}
+
+// JSONMatcher matches the JSON bodies that have a value at Path.
+type JSONMatcher struct {
+	// Path are the keys of the objects, or the indexes of the
+	// arrays, that lead to the value, like ["data", "exists"].
+	Path []string
+	// Value, if not empty, must be equal to the value at Path,
+	// like "true" or "me" for the JSON true and "me". Otherwise
+	// the value must not be null, false, 0 or an empty string.
+	Value string
+}
+
+// Match implements Matcher.
+func (m *JSONMatcher) Match(body string) bool {
+	var v interface{}
+	if err := json.Unmarshal([]byte(body), &v); err != nil {
+		return false
+	}
+
+	for _, key := range m.Path {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = node[key]; !ok {
+				return false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return false
+			}
+			v = node[i]
+		default:
+			return false
+		}
+	}
+
+	if m.Value != "" {
+		return jsonString(v) == m.Value
+	}
+
+	switch value := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return value
+	case float64:
+		return value != 0
+	case string:
+		return value != ""
+	default:
+		return true
+	}
+}
+
+// jsonString returns v as it is written in JSON,
+// except for the strings that are not quoted.
+func jsonString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return strings.TrimSpace(string(data))
+}
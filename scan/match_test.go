@@ -0,0 +1,131 @@
+package scan
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestJSONMatcher(t *testing.T) {
+	body := `{"data": {"exists": true, "missing": false, "name": "me", "count": 0, "users": [{"id": 1}]}}`
+
+	tt := []struct {
+		name     string
+		m        *JSONMatcher
+		body     string
+		expected bool
+	}{
+		{name: "true", m: &JSONMatcher{Path: []string{"data", "exists"}}, body: body, expected: true},
+		{name: "false", m: &JSONMatcher{Path: []string{"data", "missing"}}, body: body, expected: false},
+		{name: "zero", m: &JSONMatcher{Path: []string{"data", "count"}}, body: body, expected: false},
+		{name: "object", m: &JSONMatcher{Path: []string{"data"}}, body: body, expected: true},
+		{name: "missing key", m: &JSONMatcher{Path: []string{"data", "user"}}, body: body, expected: false},
+		{name: "array index", m: &JSONMatcher{Path: []string{"data", "users", "0", "id"}, Value: "1"}, body: body, expected: true},
+		{name: "index out of range", m: &JSONMatcher{Path: []string{"data", "users", "1"}}, body: body, expected: false},
+		{name: "string value", m: &JSONMatcher{Path: []string{"data", "name"}, Value: "me"}, body: body, expected: true},
+		{name: "wrong value", m: &JSONMatcher{Path: []string{"data", "exists"}, Value: "false"}, body: body, expected: false},
+		{name: "not JSON", m: &JSONMatcher{Path: []string{"data"}}, body: "<html>", expected: false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.m.Match(tc.body); got != tc.expected {
+				t.Fatalf("expected match=%v. got=%v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestSearchFoundMatch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/taken":
+			w.Write([]byte(`{"available": false}`))
+		case "/error":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"available": false}`))
+		default:
+			w.Write([]byte(`{"available": true}`))
+		}
+	}))
+	defer ts.Close()
+
+	re := &RegexpMatcher{Regexp: regexp.MustCompile(`"available":\s*false`)}
+	js := &JSONMatcher{Path: []string{"available"}, Value: "false"}
+	sites := []*Site{
+		{Name: "regexp taken", UserURL: ts.URL + "/taken", FoundMatch: re},
+		{Name: "regexp available", UserURL: ts.URL + "/available", FoundMatch: re},
+		{Name: "json taken", UserURL: ts.URL + "/taken", FoundMatch: js},
+		{Name: "json available", UserURL: ts.URL + "/available", FoundMatch: js},
+		{Name: "status first", UserURL: ts.URL + "/error", FoundMatch: js},
+		{Name: "error string after", UserURL: ts.URL + "/taken", FoundMatch: js, ErrorString: "available"},
+	}
+
+	results, err := Search(context.Background(), sites, Options{})
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	expected := map[string]bool{
+		"regexp taken":       true,
+		"regexp available":   false,
+		"json taken":         true,
+		"json available":     false,
+		"status first":       false,
+		"error string after": false,
+	}
+	for _, r := range results {
+		if r.Found != expected[r.Name] {
+			t.Fatalf("expected site %q to have found=%v. got=%v", r.Name, expected[r.Name], r.Found)
+		}
+	}
+
+	if _, err := Search(context.Background(), sites[:1], Options{Method: http.MethodHead}); err == nil {
+		t.Fatalf("expected to fail with method HEAD and a found match")
+	}
+}
+
+func TestSearchFoundHeader(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/me":
+			w.Header().Set("Location", "/users/me")
+			w.WriteHeader(http.StatusFound)
+		case "/you":
+			w.Header().Set("Location", "/login")
+			w.WriteHeader(http.StatusFound)
+		case "/cookie":
+			http.SetCookie(w, &http.Cookie{Name: "profile", Value: "me"})
+		}
+	}))
+	defer ts.Close()
+
+	location := &HeaderMatcher{Name: "location", Pattern: regexp.MustCompile("^/users/")}
+	sites := []*Site{
+		{Name: "profile redirect", UserURL: ts.URL + "/me", FoundHeader: location},
+		{Name: "login redirect", UserURL: ts.URL + "/you", FoundHeader: location},
+		{Name: "cookie", UserURL: ts.URL + "/cookie", FoundHeader: &HeaderMatcher{Name: "Set-Cookie"}},
+		{Name: "no cookie", UserURL: ts.URL + "/none", FoundHeader: &HeaderMatcher{Name: "Set-Cookie"}},
+	}
+
+	c := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	opts := Options{Client: c, Method: http.MethodHead, FoundStatus: []int{http.StatusOK, http.StatusFound}}
+	results, err := Search(context.Background(), sites, opts)
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	expected := map[string]bool{"profile redirect": true, "login redirect": false, "cookie": true, "no cookie": false}
+	for _, r := range results {
+		if r.Found != expected[r.Name] {
+			t.Fatalf("expected site %q to have found=%v. got=%v", r.Name, expected[r.Name], r.Found)
+		}
+	}
+}
@@ -0,0 +1,1016 @@
+// Package scan provides the logic to search for
+// usernames across a list of sites.
+package scan
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danielkvist/beagle/client"
+)
+
+// Site defines a site in which a username
+// is going to be searched.
+type Site struct {
+	// Name is the name of the site.
+	Name string
+	// MainURL is the URL reported for the site.
+	MainURL string
+	// UserURL is the URL that is requested to check
+	// if the username exists on the site.
+	UserURL string
+	// User is the username searched on the site.
+	User string
+	// ErrorString, if not empty, marks the username as not
+	// found when the body of the response contains it.
+	ErrorString string
+	// ErrorStrings are checked along with ErrorString. By default
+	// the username is not found when the body contains any of
+	// them, or all of them if ErrorMatchAll is true.
+	ErrorStrings []string
+	// ErrorMatchAll makes the username not found only
+	// when the body contains all the error strings.
+	ErrorMatchAll bool
+	// Headers are added to the request made to UserURL.
+	// They override the User-Agent and the Headers of the Options.
+	Headers http.Header
+	// FoundStatus, if not empty, overrides the FoundStatus
+	// of the Options for this site.
+	FoundStatus []int
+	// Invert inverts the interpretation of the status code,
+	// so the username is found when the status code of the
+	// response is not one of the found status codes.
+	Invert bool
+	// UserPattern, if not nil, must match User for
+	// the site to be checked. Otherwise it is skipped.
+	UserPattern *regexp.Regexp
+	// Cookies are added to the request made to UserURL. They
+	// override the Cookies of the Options with the same name.
+	Cookies []*http.Cookie
+	// NotFoundSize, if not nil, marks the username as not found
+	// when the size of the response is within it. It is used for
+	// sites that respond to missing profiles with a generic page.
+	NotFoundSize *SizeRange
+	// Timeout, if greater than 0, overrides the
+	// timeout of the Client for this site.
+	Timeout time.Duration
+	// BasicAuth, if not nil, overrides the
+	// BasicAuth of the Options for this site.
+	BasicAuth *Credentials
+	// Method, if not empty, overrides the
+	// Method of the Options for this site.
+	Method string
+	// Body, if not empty, is sent as the body of the request
+	// made to UserURL. Bodies that start with "{" or "[" are
+	// sent as JSON and the rest as a form, unless Headers
+	// sets the Content-Type.
+	Body string
+	// FoundMatch, if not nil, must match the body of a response
+	// whose status code marks the username as found for it to be
+	// found. Then ErrorString and NotFoundSize are still checked.
+	FoundMatch Matcher
+	// FoundHeader, if not nil, must match the headers of a
+	// response whose status code marks the username as found
+	// for it to be found, like FoundMatch does with the body.
+	FoundHeader *HeaderMatcher
+	// NotFoundRedirect, if not nil, marks the username as not
+	// found when the request is redirected to it, for sites
+	// that redirect the missing profiles to their homepage.
+	// Its scheme and a trailing slash on its path are ignored.
+	NotFoundRedirect *url.URL
+	// MinSize, if greater than 0, is the min size in bytes of
+	// the response for the username to be found, for sites that
+	// respond to missing profiles with an empty page. Like with
+	// NotFoundSize, HEAD requests use the Content-Length.
+	MinSize int64
+	// Detector, if not empty, is a command and its arguments that
+	// decide if the username is found instead of the rest of the
+	// rules. It is only run with Options.AllowExec. It reads
+	// the body of the response from its standard input and gets the
+	// names of the site and the user, the UserURL, the final URL and
+	// the status code in the BEAGLE_SITE, BEAGLE_USER, BEAGLE_USER_URL,
+	// BEAGLE_URL and BEAGLE_STATUS environment variables. An exit
+	// code of 0 finds the username, 1 does not, and any other is an
+	// error.
+	Detector []string
+}
+
+// Credentials defines the username and password
+// used for HTTP basic authentication.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// SizeRange defines an inclusive range of sizes in bytes.
+type SizeRange struct {
+	Min int64
+	Max int64
+}
+
+// Contains reports whether size is within r.
+func (r *SizeRange) Contains(size int64) bool {
+	return size >= r.Min && size <= r.Max
+}
+
+// Result defines the result of checking a Site.
+type Result struct {
+	Name       string `json:"name"`
+	MainURL    string `json:"mainURL"`
+	Username   string `json:"username"`
+	StatusCode int    `json:"statusCode"`
+	Found      bool   `json:"found"`
+	Error      string `json:"error,omitempty"`
+	// ErrorKind is the cause of Error if it is known: "timeout",
+	// "dns", "refused" or "tls", as returned by client.Kind.
+	ErrorKind string `json:"errorKind,omitempty"`
+	// Skipped reports whether the site was not checked
+	// because the username does not match its UserPattern.
+	Skipped bool `json:"skipped,omitempty"`
+	// Blocked reports whether the site responded with what
+	// looks like the challenge page of a WAF, like Cloudflare,
+	// so it is unknown if the username exists.
+	Blocked bool `json:"blocked,omitempty"`
+	// Snippet holds the first Options.Snippet bytes
+	// of the body of the response, if any.
+	Snippet string `json:"snippet,omitempty"`
+	// Redirects are the URLs to which the request made to
+	// the site was redirected, in order, with
+	// Options.TraceRedirects.
+	Redirects []string `json:"redirects,omitempty"`
+	// ElapsedMS is the time in milliseconds that the
+	// site took to respond.
+	ElapsedMS int64 `json:"elapsedMs"`
+}
+
+// Options defines the options for a Search.
+type Options struct {
+	// Client is the *http.Client used to make the requests.
+	// If nil, http.DefaultClient is used.
+	Client *http.Client
+	// Agents are the User-Agent headers set on the requests.
+	// They are used in round-robin order, one for each site.
+	Agents []string
+	// Headers are added to the requests made to every site.
+	// They override the User-Agent of Agents and are
+	// overridden by the Headers of each Site.
+	Headers http.Header
+	// Cookies are added to the requests made to every site.
+	Cookies []*http.Cookie
+	// BasicAuth, if not nil, is used to authenticate
+	// the requests made to every site.
+	BasicAuth *Credentials
+	// Method is the HTTP method used on the requests. It can be
+	// http.MethodGet, http.MethodHead or http.MethodPost. If empty,
+	// GET is used. HEAD can not be used with sites that have an
+	// ErrorString.
+	Method string
+	// FoundStatus are the status codes that mark a username
+	// as found. If empty, only http.StatusOK is used.
+	FoundStatus []int
+	// Goroutines is the number of workers that check the sites
+	// concurrently. Values lower than 1 are treated as 1, and
+	// no more workers than sites are started.
+	Goroutines int
+	// MaxPerHost, if greater than 0, is the max number of
+	// sites with the same MainURL host that are checked at the
+	// same time, so no host receives more concurrent requests.
+	// The workers wait for the sites of a busy host, so the
+	// sites of a file should not be sorted by host.
+	MaxPerHost int
+	// Rate is the max number of sites that are checked per
+	// second, independently of Goroutines. If it is 0 or
+	// lower there is no limit.
+	Rate float64
+	// Retries is the number of times a request is retried
+	// after a network error, a 429 or a 5xx response.
+	Retries int
+	// RetryBackoff is the time to wait before the first retry.
+	// The next ones depend on Backoff. A 429 response with a
+	// Retry-After header waits for the indicated time instead.
+	RetryBackoff time.Duration
+	// Backoff is the strategy used to wait between the retries:
+	// BackoffFixed, BackoffExponential or BackoffFullJitter. If
+	// empty, BackoffExponential is used.
+	Backoff string
+	// MaxBackoff, if greater than 0, is the max time to wait
+	// between two retries, even if a Retry-After asks for more.
+	MaxBackoff time.Duration
+	// RequestTimeout, if greater than 0, is the max time that
+	// the requests to a URL of each site can take, retries
+	// included. The timeout of the Client, or of the Site, and
+	// the deadline of the context of Search still apply, so the
+	// first one to expire ends the request.
+	RequestTimeout time.Duration
+	// TraceRedirects, if true, records the URLs to which
+	// the requests are redirected in Result.Redirects.
+	TraceRedirects bool
+	// Delay is the time that each worker waits before
+	// checking a site, even with a single Goroutine.
+	Delay time.Duration
+	// Jitter randomizes Delay, which is increased or
+	// decreased by up to Jitter on every site.
+	Jitter time.Duration
+	// AllowExec, if true, allows to run the Detector of the
+	// sites. Otherwise, Search fails if any site has one.
+	AllowExec bool
+	// CheckMainURL, if true, requests the MainURL of the sites
+	// whose UserURL does not find the username, when they are
+	// different, and finds it if the status code of the MainURL
+	// does. The rules for the body, the headers and the redirects
+	// of a Site only apply to its UserURL.
+	CheckMainURL bool
+	// MaxBodyBytes, if greater than 0, is the max number of bytes
+	// of the body of a response that are read, once decoded. The
+	// rules of the sites, including the size ones, are checked
+	// against the truncated body.
+	MaxBodyBytes int64
+	// Snippet, if greater than 0, is the number of bytes of the
+	// body of each response that are kept in Result.Snippet.
+	Snippet int
+	// Results, if not nil, receives every Result as soon as
+	// it is available. Search does not close it.
+	Results chan<- *Result
+	// OnResult, if not nil, is called with every Result as soon
+	// as it is available. The calls are made one at a time from
+	// a single goroutine, so OnResult does not need to synchronize
+	// its own state, and none is made after Search returns. A slow
+	// OnResult delays the next results and then the workers.
+	OnResult func(*Result)
+	// OnTrace, if not nil, is called with the Trace of every
+	// request made, retries included, from the goroutine that
+	// made it, so it can be called concurrently.
+	OnTrace func(*Trace)
+}
+
+// Search checks concurrently every one of the received sites and
+// returns their results. If ctx is done before all the sites
+// have been checked it returns the results obtained so far
+// along with the error of ctx.
+func Search(ctx context.Context, sites []*Site, opts Options) ([]*Result, error) {
+	c := opts.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+
+	goroutines := opts.Goroutines
+	if goroutines > len(sites) {
+		goroutines = len(sites)
+	}
+	if goroutines < 1 {
+		goroutines = 1
+	}
+
+	if opts.Method == "" {
+		opts.Method = http.MethodGet
+	}
+
+	if len(opts.FoundStatus) == 0 {
+		opts.FoundStatus = []int{http.StatusOK}
+	}
+
+	if err := validateMethod(opts.Method, sites); err != nil {
+		return nil, err
+	}
+
+	if !opts.AllowExec {
+		for _, s := range sites {
+			if len(s.Detector) > 0 {
+				return nil, fmt.Errorf("site %q has a detector command, which is only run with AllowExec", s.Name)
+			}
+		}
+	}
+
+	switch opts.Backoff {
+	case "":
+		opts.Backoff = BackoffExponential
+	case BackoffFixed, BackoffExponential, BackoffFullJitter:
+	default:
+		return nil, fmt.Errorf("backoff %q is not supported, use %s, %s or %s", opts.Backoff, BackoffFixed, BackoffExponential, BackoffFullJitter)
+	}
+
+	out := make(chan *Result, goroutines)
+	jobs := make(chan job)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	results := []*Result{}
+	go func() {
+		defer close(done)
+		for r := range out {
+			results = append(results, r)
+			if opts.OnResult != nil {
+				opts.OnResult(r)
+			}
+			if opts.Results != nil {
+				opts.Results <- r
+			}
+		}
+	}()
+
+	hosts := newHostLimiter(opts.MaxPerHost)
+	for w := 0; w < goroutines; w++ {
+		wg.Add(1)
+		go worker(ctx, c, &opts, hosts, jobs, out, &wg)
+	}
+
+	var tick <-chan time.Time
+	if opts.Rate > 0 {
+		ticker := time.NewTicker(rateInterval(opts.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+dispatch:
+	for i, s := range sites {
+		if tick != nil && i > 0 {
+			select {
+			case <-ctx.Done():
+				break dispatch
+			case <-tick:
+			}
+		}
+
+		var agent string
+		if len(opts.Agents) > 0 {
+			agent = opts.Agents[i%len(opts.Agents)]
+		}
+
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case jobs <- job{site: s, agent: agent}:
+		}
+	}
+
+	// The workers send the result of every check before calling
+	// wg.Done, so out can only be closed once all of them have
+	// returned. Then the collector is waited so no Result is sent
+	// to opts.Results, or to opts.OnResult, after Search returns.
+	close(jobs)
+	wg.Wait()
+	close(out)
+	<-done
+
+	return results, ctx.Err()
+}
+
+// FoundByUser groups the found results of results by their
+// Username, keeping their order. The usernames that are not
+// found on any site are not in the map.
+func FoundByUser(results []*Result) map[string][]*Result {
+	byUser := map[string][]*Result{}
+	for _, r := range results {
+		if r.Found {
+			byUser[r.Username] = append(byUser[r.Username], r)
+		}
+	}
+
+	return byUser
+}
+
+func validateMethod(method string, sites []*Site) error {
+	if !supportedMethod(method) {
+		return fmt.Errorf("method %q is not supported, use %s, %s or %s", method, http.MethodGet, http.MethodHead, http.MethodPost)
+	}
+
+	for _, s := range sites {
+		m := siteMethod(s, method)
+		if !supportedMethod(m) {
+			return fmt.Errorf("method %q of site %q is not supported, use %s, %s or %s", m, s.Name, http.MethodGet, http.MethodHead, http.MethodPost)
+		}
+
+		if m == http.MethodHead && len(errorStrings(s)) > 0 {
+			return fmt.Errorf("method %s can not be used with site %q because it has an error string", m, s.Name)
+		}
+
+		if m == http.MethodHead && s.FoundMatch != nil {
+			return fmt.Errorf("method %s can not be used with site %q because it has a found match", m, s.Name)
+		}
+	}
+
+	return nil
+}
+
+func supportedMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost:
+		return true
+	default:
+		return false
+	}
+}
+
+// siteMethod returns the method used
+// on the requests made to site.
+func siteMethod(site *Site, method string) string {
+	if site.Method != "" {
+		return site.Method
+	}
+
+	return method
+}
+
+// job is a site that is checked by a worker.
+type job struct {
+	site  *Site
+	agent string
+}
+
+// worker checks the sites received from jobs until it is
+// closed and sends their results to out.
+func worker(ctx context.Context, c *http.Client, opts *Options, hosts *hostLimiter, jobs <-chan job, out chan<- *Result, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for j := range jobs {
+		release, err := hosts.acquire(ctx, j.site)
+		if err != nil {
+			r := newResult(j.site)
+			r.Error = err.Error()
+			out <- r
+			continue
+		}
+
+		out <- check(ctx, j.site, c, j.agent, opts)
+		release()
+	}
+}
+
+// newResult returns the Result of site before checking it.
+func newResult(site *Site) *Result {
+	return &Result{
+		Name:     site.Name,
+		MainURL:  site.MainURL,
+		Username: site.User,
+	}
+}
+
+func check(ctx context.Context, site *Site, c *http.Client, agent string, opts *Options) *Result {
+	r := newResult(site)
+
+	if site.UserPattern != nil && !site.UserPattern.MatchString(site.User) {
+		r.Skipped = true
+		return r
+	}
+
+	if d := requestDelay(opts.Delay, opts.Jitter, rand.Int63n); d > 0 {
+		select {
+		case <-ctx.Done():
+			r.Error = ctx.Err().Error()
+			return r
+		case <-time.After(d):
+		}
+	}
+
+	sized := site.NotFoundSize != nil || site.MinSize > 0
+	readBody := len(errorStrings(site)) > 0 || site.FoundMatch != nil || ((sized || len(site.Detector) > 0) && siteMethod(site, opts.Method) != http.MethodHead)
+	resp, err := makeTimedRequest(ctx, c, site, agent, readBody, opts)
+	if err != nil {
+		r.Error = err.Error()
+		r.ErrorKind = client.Kind(err)
+	}
+
+	r.StatusCode = resp.statusCode
+	r.Snippet = resp.snippet
+	r.Redirects = resp.redirects
+	r.ElapsedMS = resp.elapsed.Milliseconds()
+	statusFound := siteStatusFound(site, opts, resp.statusCode)
+	if err == nil && blocked(resp.statusCode, resp.header) {
+		r.Blocked = true
+		return r
+	}
+
+	if err == nil && len(site.Detector) > 0 {
+		r.Found, err = runDetector(ctx, site, resp, detectorTimeout(site, c, opts))
+		if err != nil {
+			r.Error = err.Error()
+		}
+		return r
+	}
+
+	r.Found = err == nil && statusFound
+	if r.Found && site.FoundMatch != nil && !site.FoundMatch.Match(resp.body) {
+		r.Found = false
+	}
+
+	if r.Found && site.FoundHeader != nil && !site.FoundHeader.Match(resp.header) {
+		r.Found = false
+	}
+
+	if r.Found && containsErrors(resp.body, errorStrings(site), site.ErrorMatchAll) {
+		r.Found = false
+	}
+
+	if r.Found && site.NotFoundSize != nil && resp.size >= 0 && site.NotFoundSize.Contains(resp.size) {
+		r.Found = false
+	}
+
+	if r.Found && site.MinSize > 0 && resp.size >= 0 && resp.size < site.MinSize {
+		r.Found = false
+	}
+
+	if r.Found && site.NotFoundRedirect != nil && sameURL(resp.url, site.NotFoundRedirect) {
+		r.Found = false
+	}
+
+	if !r.Found && opts.CheckMainURL && site.MainURL != "" && site.MainURL != site.UserURL {
+		checkMainURL(ctx, site, c, agent, opts, r)
+	}
+
+	return r
+}
+
+// checkMainURL requests the MainURL of site and marks r as
+// found, without its error, if its status code finds the user.
+func checkMainURL(ctx context.Context, site *Site, c *http.Client, agent string, opts *Options, r *Result) {
+	main := &Site{
+		Name:        site.Name,
+		MainURL:     site.MainURL,
+		UserURL:     site.MainURL,
+		User:        site.User,
+		Headers:     site.Headers,
+		FoundStatus: site.FoundStatus,
+		Invert:      site.Invert,
+		Cookies:     site.Cookies,
+		Timeout:     site.Timeout,
+		BasicAuth:   site.BasicAuth,
+		Method:      siteMethod(site, opts.Method),
+	}
+	// The Body of site is meant for its UserURL.
+	if main.Method == http.MethodPost {
+		main.Method = http.MethodGet
+	}
+
+	resp, err := makeTimedRequest(ctx, c, main, agent, false, opts)
+	if err != nil || blocked(resp.statusCode, resp.header) || !siteStatusFound(main, opts, resp.statusCode) {
+		return
+	}
+
+	r.Found = true
+	r.StatusCode = resp.statusCode
+	r.Error = ""
+	r.ErrorKind = ""
+}
+
+// siteStatusFound reports whether statusCode finds
+// the username on site according to its FoundStatus,
+// or the one of opts, and Invert.
+func siteStatusFound(site *Site, opts *Options, statusCode int) bool {
+	foundStatus := opts.FoundStatus
+	if len(site.FoundStatus) > 0 {
+		foundStatus = site.FoundStatus
+	}
+
+	found := containsStatus(foundStatus, statusCode)
+	if site.Invert {
+		found = !found
+	}
+
+	return found
+}
+
+// sameURL reports whether u and target have the same host, path
+// and query, ignoring their scheme and the trailing slashes.
+func sameURL(u, target *url.URL) bool {
+	if u == nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, target.Host) &&
+		strings.TrimSuffix(u.Path, "/") == strings.TrimSuffix(target.Path, "/") &&
+		u.RawQuery == target.RawQuery
+}
+
+// errorStrings returns the ErrorString
+// and the ErrorStrings of site.
+func errorStrings(site *Site) []string {
+	if site.ErrorString == "" {
+		return site.ErrorStrings
+	}
+
+	return append([]string{site.ErrorString}, site.ErrorStrings...)
+}
+
+// containsErrors reports whether body contains any of errs,
+// or all of them if all is true. It is false if errs is empty.
+func containsErrors(body string, errs []string, all bool) bool {
+	if len(errs) == 0 {
+		return false
+	}
+
+	for _, e := range errs {
+		contains := strings.Contains(body, e)
+		if all && !contains {
+			return false
+		}
+		if !all && contains {
+			return true
+		}
+	}
+
+	return all
+}
+
+func hasCookie(cookies []*http.Cookie, name string) bool {
+	for _, c := range cookies {
+		if c.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// blocked reports whether a response with statusCode and
+// header looks like the challenge page of a WAF. Those pages
+// use a 403, 429 or 503 and are identified by the headers
+// that Cloudflare, Akamai and Sucuri add to their responses.
+func blocked(statusCode int, header http.Header) bool {
+	switch statusCode {
+	case http.StatusForbidden, http.StatusTooManyRequests, http.StatusServiceUnavailable:
+	default:
+		return false
+	}
+
+	server := strings.ToLower(header.Get("Server"))
+	return header.Get("CF-Ray") != "" ||
+		strings.Contains(server, "cloudflare") ||
+		strings.Contains(server, "akamaighost") ||
+		header.Get("X-Sucuri-ID") != ""
+}
+
+func containsStatus(codes []int, code int) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// response holds the parts of an *http.Response
+// that are needed to check a site.
+type response struct {
+	statusCode int
+	header     http.Header
+	// url is the URL of the last request, which is
+	// not the UserURL after following redirects.
+	url  *url.URL
+	body string
+	// size is the length of the body if it has been read,
+	// or the Content-Length of the response otherwise.
+	// It is -1 if it is unknown.
+	size int64
+	// redirects are the URLs to which the request
+	// was redirected, with opts.TraceRedirects.
+	redirects []string
+	// snippet holds the first opts.Snippet bytes of the body.
+	snippet string
+	elapsed time.Duration
+	// retryAfter is the time to wait indicated by the
+	// Retry-After header of a 429 response, if any.
+	retryAfter time.Duration
+}
+
+// makeRequest makes a request to the UserURL of site using its
+// method, or opts.Method if it has none, and with agent as its
+// User-Agent header and returns its response. The body of the
+// response is only read if readBody is true. Requests that fail
+// with a network error, a 429 or a 5xx response are retried up to
+// opts.Retries times, waiting as opts.Backoff says or for the time
+// indicated by the Retry-After header of a 429 or a 503, both
+// capped by opts.MaxBackoff.
+func makeRequest(ctx context.Context, c *http.Client, site *Site, agent string, readBody bool, opts *Options) (response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := doRequest(ctx, c, site, agent, readBody, opts)
+		if attempt >= opts.Retries || !retryable(resp.statusCode, err) || ctx.Err() != nil {
+			return resp, err
+		}
+
+		wait := retryWait(opts.Backoff, opts.RetryBackoff, opts.MaxBackoff, attempt, rand.Int63n)
+		if resp.retryAfter > 0 {
+			wait = resp.retryAfter
+			if opts.MaxBackoff > 0 && wait > opts.MaxBackoff {
+				wait = opts.MaxBackoff
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return resp, err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Strategies used to wait between the retries.
+const (
+	// BackoffFixed always waits for the RetryBackoff.
+	BackoffFixed = "fixed"
+	// BackoffExponential doubles the wait after every retry.
+	BackoffExponential = "exponential"
+	// BackoffFullJitter waits for a random time between 0
+	// and the wait of BackoffExponential, so the workers
+	// that retry the same site do not do it at once.
+	BackoffFullJitter = "full-jitter"
+)
+
+// retryWait returns the time to wait before the retry that
+// follows attempt, starting at 0, with strategy, base and a max
+// that caps it if it is greater than 0. rnd returns a number in
+// [0,n) for BackoffFullJitter. The wait saturates at the max
+// time.Duration instead of overflowing.
+func retryWait(strategy string, base, max time.Duration, attempt int, rnd func(n int64) int64) time.Duration {
+	wait := base
+	if strategy != BackoffFixed {
+		for i := 0; i < attempt && (max <= 0 || wait < max); i++ {
+			if wait > math.MaxInt64/2 {
+				wait = math.MaxInt64
+				break
+			}
+			wait *= 2
+		}
+	}
+
+	if max > 0 && wait > max {
+		wait = max
+	}
+
+	if strategy == BackoffFullJitter {
+		n := int64(wait)
+		if n < math.MaxInt64 {
+			n++
+		}
+		wait = time.Duration(rnd(n))
+	}
+
+	return wait
+}
+
+// makeTimedRequest calls makeRequest with a context
+// that expires after opts.RequestTimeout, if it is set.
+func makeTimedRequest(ctx context.Context, c *http.Client, site *Site, agent string, readBody bool, opts *Options) (response, error) {
+	if opts.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.RequestTimeout)
+		defer cancel()
+	}
+
+	return makeRequest(ctx, c, site, agent, readBody, opts)
+}
+
+// rateInterval returns the time between the sites checked with
+// rate sites per second, which must be positive. It is at least
+// 1ns and, for rates too low to be represented, the max Duration.
+func rateInterval(rate float64) time.Duration {
+	interval := float64(time.Second) / rate
+	switch {
+	case interval < 1:
+		return 1
+	case interval >= math.MaxInt64:
+		return math.MaxInt64
+	default:
+		return time.Duration(interval)
+	}
+}
+
+// requestDelay returns delay increased or decreased by a random
+// duration of up to jitter obtained with rnd, which returns
+// a number in [0,n). It is never negative.
+func requestDelay(delay, jitter time.Duration, rnd func(n int64) int64) time.Duration {
+	if jitter > 0 {
+		delay += time.Duration(rnd(int64(2*jitter)+1)) - jitter
+	}
+
+	if delay < 0 {
+		return 0
+	}
+
+	return delay
+}
+
+func retryable(statusCode int, err error) bool {
+	return err != nil || statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
+
+// parseRetryAfter returns the time to wait indicated by a
+// Retry-After header, which can be a number of seconds or
+// an HTTP-date. It returns 0 if v is not valid.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0
+	}
+
+	if d := t.Sub(now); d > 0 {
+		return d
+	}
+
+	return 0
+}
+
+func doRequest(ctx context.Context, c *http.Client, site *Site, agent string, readBody bool, opts *Options) (response, error) {
+	if site.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, site.Timeout)
+		defer cancel()
+
+		withoutTimeout := *c
+		withoutTimeout.Timeout = 0
+		c = &withoutTimeout
+	}
+
+	var redirects []string
+	if opts.TraceRedirects {
+		traced := *c
+		traced.CheckRedirect = traceRedirects(c.CheckRedirect, &redirects)
+		c = &traced
+	}
+
+	var reqBody io.Reader
+	if site.Body != "" {
+		reqBody = strings.NewReader(site.Body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, siteMethod(site, opts.Method), site.UserURL, reqBody)
+	if err != nil {
+		return response{}, err
+	}
+	req.Header.Set("User-Agent", agent)
+	if site.Body != "" {
+		req.Header.Set("Content-Type", bodyContentType(site.Body))
+	}
+	for k, v := range opts.Headers {
+		req.Header[k] = v
+	}
+	for k, v := range site.Headers {
+		req.Header[k] = v
+	}
+
+	for _, cookie := range opts.Cookies {
+		if !hasCookie(site.Cookies, cookie.Name) {
+			req.AddCookie(cookie)
+		}
+	}
+	for _, cookie := range site.Cookies {
+		req.AddCookie(cookie)
+	}
+
+	auth := opts.BasicAuth
+	if site.BasicAuth != nil {
+		auth = site.BasicAuth
+	}
+	if auth != nil {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+
+	start := time.Now()
+	var tr *tracer
+	if opts.OnTrace != nil {
+		tr = newTracer(start)
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), tr.clientTrace()))
+	}
+
+	resp, err := c.Do(req)
+	elapsed := time.Since(start)
+	if tr != nil {
+		opts.OnTrace(tr.done(site, resp, elapsed, err))
+	}
+	if err != nil {
+		return response{redirects: redirects, elapsed: elapsed}, client.Classify(err)
+	}
+	defer closeBody(resp.Body)
+
+	r := response{statusCode: resp.StatusCode, header: resp.Header, url: resp.Request.URL, size: resp.ContentLength, redirects: redirects, elapsed: elapsed}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		r.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	if !readBody {
+		if opts.Snippet > 0 {
+			// The snippet is only informative, so a body
+			// that can not be read does not fail the check.
+			snippet, _ := decodeBody(resp, int64(opts.Snippet))
+			r.snippet = string(snippet)
+		}
+		return r, nil
+	}
+
+	limit := int64(-1)
+	if opts.MaxBodyBytes > 0 {
+		limit = opts.MaxBodyBytes
+	}
+
+	body, err := decodeBody(resp, limit)
+	if err != nil {
+		return r, fmt.Errorf("while reading body from %q: %v", site.UserURL, err)
+	}
+
+	r.body = string(body)
+	r.size = int64(len(body))
+	if opts.Snippet > 0 {
+		r.snippet = r.body
+		if len(r.snippet) > opts.Snippet {
+			r.snippet = r.snippet[:opts.Snippet]
+		}
+	}
+	return r, nil
+}
+
+// traceRedirects returns a CheckRedirect function for an
+// *http.Client that appends to redirects the URL of every
+// redirect that check, or the default policy of the
+// http.Client if it is nil, lets it follow.
+func traceRedirects(check func(*http.Request, []*http.Request) error, redirects *[]string) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if check != nil {
+			if err := check(req, via); err != nil {
+				return err
+			}
+		} else if len(via) >= 10 {
+			return fmt.Errorf("stopped after 10 redirects")
+		}
+
+		*redirects = append(*redirects, req.URL.String())
+		return nil
+	}
+}
+
+// drainLimit is the max number of bytes of a body that
+// are read and discarded before closing it so its
+// connection can be reused.
+const drainLimit = 1 << 20
+
+// closeBody drains and closes body. The http.Transport only
+// reuses the connection of a response whose body has been
+// fully read, so bodies that are not needed are drained too.
+func closeBody(body io.ReadCloser) {
+	io.Copy(ioutil.Discard, io.LimitReader(body, drainLimit))
+	body.Close()
+}
+
+// bodyContentType returns the Content-Type of body.
+func bodyContentType(body string) string {
+	body = strings.TrimSpace(body)
+	if strings.HasPrefix(body, "{") || strings.HasPrefix(body, "[") {
+		return "application/json"
+	}
+
+	return "application/x-www-form-urlencoded"
+}
+
+// decodeBody reads the body of resp. Bodies are decoded by the
+// http.Transport only when it sets the Accept-Encoding header
+// itself, so the ones that are still compressed because a site
+// sets that header are decoded here. If limit is not negative,
+// only up to limit bytes of the decoded body are read.
+func decodeBody(resp *http.Response, limit int64) ([]byte, error) {
+	var r io.Reader = resp.Body
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "gzip":
+		gr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+	case "deflate":
+		zr, err := zlib.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	if limit >= 0 {
+		r = io.LimitReader(r, limit)
+	}
+
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,1538 @@
+package scan
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMakeRequest(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		switch r.URL.String() {
+		case "/ok":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("profile"))
+		case "/notfound":
+			w.WriteHeader(http.StatusNotFound)
+		case "/internalerror":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	tt := []struct {
+		name               string
+		url                string
+		expectedToFail     bool
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			name:           "no URL",
+			url:            "",
+			expectedToFail: true,
+		},
+		{
+			name:               "ok",
+			url:                ts.URL + "/ok",
+			expectedToFail:     false,
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       "profile",
+		},
+		{
+			name:               "404",
+			url:                ts.URL + "/notfound",
+			expectedToFail:     false,
+			expectedStatusCode: http.StatusNotFound,
+		},
+		{
+			name:               "500",
+			url:                ts.URL + "/internalerror",
+			expectedToFail:     false,
+			expectedStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	c := &http.Client{}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := makeRequest(context.Background(), c, &Site{UserURL: tc.url}, "", true, &Options{Method: http.MethodGet})
+			if err != nil && !tc.expectedToFail {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+
+			if resp.statusCode != tc.expectedStatusCode {
+				t.Fatalf("expected a %v as status code. got=%v", tc.expectedStatusCode, resp.statusCode)
+			}
+
+			if resp.body != tc.expectedBody {
+				t.Fatalf("expected %q as body. got=%q", tc.expectedBody, resp.body)
+			}
+		})
+	}
+}
+
+func TestSearchCompressedBody(t *testing.T) {
+	compress := func(encoding string, body string) []byte {
+		var b bytes.Buffer
+		var w io.WriteCloser = gzip.NewWriter(&b)
+		if encoding == "deflate" {
+			w = zlib.NewWriter(&b)
+		}
+		w.Write([]byte(body))
+		w.Close()
+		return b.Bytes()
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := "the profile of the user"
+		if r.URL.Path == "/missing" {
+			body = "user not found"
+		}
+
+		encoding := r.Header.Get("Accept-Encoding")
+		if encoding != "gzip" && encoding != "deflate" {
+			w.Write([]byte(body))
+			return
+		}
+
+		w.Header().Set("Content-Encoding", encoding)
+		w.Write(compress(encoding, body))
+	}))
+	defer ts.Close()
+
+	var sites []*Site
+	for _, encoding := range []string{"", "gzip", "deflate"} {
+		var headers http.Header
+		if encoding != "" {
+			headers = http.Header{"Accept-Encoding": {encoding}}
+		}
+
+		sites = append(sites,
+			&Site{Name: encoding + " missing", UserURL: ts.URL + "/missing", ErrorString: "not found", Headers: headers},
+			&Site{Name: encoding + " existing", UserURL: ts.URL + "/existing", ErrorString: "not found", Headers: headers},
+		)
+	}
+
+	results, err := Search(context.Background(), sites, Options{})
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	for _, r := range results {
+		if r.Error != "" {
+			t.Fatalf("not expected site %q to fail: %v", r.Name, r.Error)
+		}
+
+		expected := strings.HasSuffix(r.Name, "existing")
+		if r.Found != expected {
+			t.Fatalf("expected site %q to have found=%v. got=%v", r.Name, expected, r.Found)
+		}
+	}
+}
+
+func TestMakeRequestReusesConnections(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte("profile "), 40000))
+	}))
+
+	var mu sync.Mutex
+	var conns int
+	ts.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	c := &http.Client{Transport: &http.Transport{}}
+	for _, readBody := range []bool{false, true, false, false, true} {
+		if _, err := makeRequest(context.Background(), c, &Site{UserURL: ts.URL}, "", readBody, &Options{Method: http.MethodGet}); err != nil {
+			t.Fatalf("not expected to fail: %v", err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if conns != 1 {
+		t.Fatalf("expected %v connection to be reused. got=%v connections", 1, conns)
+	}
+}
+
+func BenchmarkMakeRequest(b *testing.B) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte("profile "), 40000))
+	}))
+	defer ts.Close()
+
+	c := &http.Client{Transport: &http.Transport{}}
+	site := &Site{UserURL: ts.URL}
+	opts := &Options{Method: http.MethodGet}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := makeRequest(context.Background(), c, site, "", false, opts); err != nil {
+			b.Fatalf("not expected to fail: %v", err)
+		}
+	}
+}
+
+func TestMakeRequestRetries(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+	}))
+	defer ts.Close()
+
+	tt := []struct {
+		name               string
+		retries            int
+		expectedRequests   int
+		expectedStatusCode int
+	}{
+		{
+			name:               "no retries",
+			retries:            0,
+			expectedRequests:   1,
+			expectedStatusCode: http.StatusServiceUnavailable,
+		},
+		{
+			name:               "not enough retries",
+			retries:            1,
+			expectedRequests:   2,
+			expectedStatusCode: http.StatusServiceUnavailable,
+		},
+		{
+			name:               "enough retries",
+			retries:            5,
+			expectedRequests:   3,
+			expectedStatusCode: http.StatusOK,
+		},
+	}
+
+	c := &http.Client{}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			requests = 0
+			opts := &Options{Method: http.MethodGet, Retries: tc.retries, RetryBackoff: time.Millisecond}
+			resp, err := makeRequest(context.Background(), c, &Site{UserURL: ts.URL}, "", false, opts)
+			if err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+
+			if resp.statusCode != tc.expectedStatusCode {
+				t.Fatalf("expected a %v as status code. got=%v", tc.expectedStatusCode, resp.statusCode)
+			}
+
+			if requests != tc.expectedRequests {
+				t.Fatalf("expected %v requests. got=%v", tc.expectedRequests, requests)
+			}
+		})
+	}
+}
+
+func TestMakeRequestRetryAfter(t *testing.T) {
+	var requests int
+	var last time.Time
+	var waited time.Duration
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			last = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		waited = time.Since(last)
+	}))
+	defer ts.Close()
+
+	opts := &Options{Method: http.MethodGet, Retries: 1, RetryBackoff: time.Millisecond}
+	resp, err := makeRequest(context.Background(), &http.Client{}, &Site{UserURL: ts.URL}, "", false, opts)
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	if resp.statusCode != http.StatusOK {
+		t.Fatalf("expected a %v as status code. got=%v", http.StatusOK, resp.statusCode)
+	}
+
+	if waited < time.Second {
+		t.Fatalf("expected to wait at least %v before retrying. got=%v", time.Second, waited)
+	}
+}
+
+func TestMakeRequestRetryAfterMaxBackoff(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "86400")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	opts := &Options{Method: http.MethodGet, Retries: 1, RetryBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+	start := time.Now()
+	resp, err := makeRequest(context.Background(), &http.Client{}, &Site{UserURL: ts.URL}, "", false, opts)
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	if resp.statusCode != http.StatusOK {
+		t.Fatalf("expected a %v as status code. got=%v", http.StatusOK, resp.statusCode)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the Retry-After to be capped by %v. got a wait of %v", opts.MaxBackoff, elapsed)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2019, time.December, 1, 10, 0, 0, 0, time.UTC)
+	tt := []struct {
+		name     string
+		value    string
+		expected time.Duration
+	}{
+		{name: "empty", value: "", expected: 0},
+		{name: "seconds", value: "120", expected: 2 * time.Minute},
+		{name: "negative seconds", value: "-1", expected: 0},
+		{name: "http date", value: "Sun, 01 Dec 2019 10:00:30 GMT", expected: 30 * time.Second},
+		{name: "past http date", value: "Sun, 01 Dec 2019 09:00:00 GMT", expected: 0},
+		{name: "invalid", value: "soon", expected: 0},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			d := parseRetryAfter(tc.value, now)
+			if d != tc.expected {
+				t.Fatalf("expected %v as duration. got=%v", tc.expected, d)
+			}
+		})
+	}
+}
+
+func TestMakeRequestHeaders(t *testing.T) {
+	var got http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer ts.Close()
+
+	site := &Site{
+		UserURL: ts.URL,
+		Headers: http.Header{"Accept": {"text/html"}, "Referer": {"https://me.com"}},
+	}
+
+	opts := &Options{
+		Method:  http.MethodGet,
+		Headers: http.Header{"Accept": {"*/*"}, "Accept-Language": {"en"}},
+	}
+
+	c := &http.Client{}
+	if _, err := makeRequest(context.Background(), c, site, "beagle", false, opts); err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	expected := map[string]string{"Accept": "text/html", "Accept-Language": "en", "Referer": "https://me.com", "User-Agent": "beagle"}
+	for k, v := range expected {
+		if got.Get(k) != v {
+			t.Fatalf("expected header %q to be %q. got=%q", k, v, got.Get(k))
+		}
+	}
+}
+
+func TestMakeRequestCookies(t *testing.T) {
+	var got []*http.Cookie
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Cookies()
+	}))
+	defer ts.Close()
+
+	site := &Site{
+		UserURL: ts.URL,
+		Cookies: []*http.Cookie{{Name: "session", Value: "site"}},
+	}
+
+	opts := &Options{
+		Method:  http.MethodGet,
+		Cookies: []*http.Cookie{{Name: "session", Value: "global"}, {Name: "lang", Value: "en"}},
+	}
+
+	if _, err := makeRequest(context.Background(), &http.Client{}, site, "beagle", false, opts); err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	expected := map[string]string{"lang": "en", "session": "site"}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v cookies. got=%v", len(expected), got)
+	}
+
+	for _, c := range got {
+		if expected[c.Name] != c.Value {
+			t.Fatalf("expected cookie %q to be %q. got=%q", c.Name, expected[c.Name], c.Value)
+		}
+	}
+}
+
+func TestMakeRequestBasicAuth(t *testing.T) {
+	var user, pass string
+	var ok bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok = r.BasicAuth()
+	}))
+	defer ts.Close()
+
+	global := &Credentials{Username: "global", Password: "secret"}
+	tt := []struct {
+		name         string
+		global       *Credentials
+		site         *Credentials
+		expectedAuth bool
+		expectedUser string
+	}{
+		{name: "no auth"},
+		{name: "global", global: global, expectedAuth: true, expectedUser: "global"},
+		{name: "site override", global: global, site: &Credentials{Username: "site", Password: "pass"}, expectedAuth: true, expectedUser: "site"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			site := &Site{UserURL: ts.URL, BasicAuth: tc.site}
+			opts := &Options{Method: http.MethodGet, BasicAuth: tc.global}
+			if _, err := makeRequest(context.Background(), &http.Client{}, site, "", false, opts); err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+
+			if ok != tc.expectedAuth {
+				t.Fatalf("expected basic auth=%v. got=%v", tc.expectedAuth, ok)
+			}
+
+			if ok && (user != tc.expectedUser || pass == "") {
+				t.Fatalf("expected user %q with a password. got=%q and %q", tc.expectedUser, user, pass)
+			}
+		})
+	}
+}
+
+func TestMakeRequestSiteTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	tt := []struct {
+		name           string
+		clientTimeout  time.Duration
+		siteTimeout    time.Duration
+		expectedToFail bool
+	}{
+		{name: "client timeout", clientTimeout: 10 * time.Millisecond, expectedToFail: true},
+		{name: "longer site timeout", clientTimeout: 10 * time.Millisecond, siteTimeout: time.Second},
+		{name: "shorter site timeout", clientTimeout: time.Second, siteTimeout: 10 * time.Millisecond, expectedToFail: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &http.Client{Timeout: tc.clientTimeout}
+			site := &Site{UserURL: ts.URL, Timeout: tc.siteTimeout}
+			_, err := makeRequest(context.Background(), c, site, "", false, &Options{Method: http.MethodGet})
+			if tc.expectedToFail && err == nil {
+				t.Fatalf("expected to fail")
+			}
+
+			if !tc.expectedToFail && err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.String() {
+		case "/me":
+			w.Write([]byte("profile"))
+		case "/soft":
+			w.Write([]byte("user not found"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	sites := []*Site{
+		{Name: "ok", UserURL: ts.URL + "/me"},
+		{Name: "notfound", UserURL: ts.URL + "/you"},
+		{Name: "soft", UserURL: ts.URL + "/soft", ErrorString: "not found"},
+		{Name: "error", UserURL: ""},
+		{Name: "skipped", UserURL: ts.URL + "/me", User: "me", UserPattern: regexp.MustCompile(`^[a-z]{3,}$`)},
+	}
+
+	results, err := Search(context.Background(), sites, Options{Goroutines: 2})
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	if len(results) != len(sites) {
+		t.Fatalf("expected %v results. got=%v", len(sites), len(results))
+	}
+
+	expected := map[string]bool{"ok": true, "notfound": false, "soft": false, "error": false, "skipped": false}
+	for _, r := range results {
+		if r.Skipped != (r.Name == "skipped") {
+			t.Fatalf("expected site %q to have skipped=%v. got=%v", r.Name, r.Name == "skipped", r.Skipped)
+		}
+
+		if r.Found != expected[r.Name] {
+			t.Fatalf("expected site %q to have found=%v. got=%v", r.Name, expected[r.Name], r.Found)
+		}
+
+		if r.Name == "error" && r.Error == "" {
+			t.Fatalf("expected site %q to have an error", r.Name)
+		}
+	}
+}
+
+func TestSearchMethod(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer ts.Close()
+
+	tt := []struct {
+		name           string
+		method         string
+		site           *Site
+		expectedToFail bool
+		expectedFound  bool
+	}{
+		{
+			name:          "head",
+			method:        http.MethodHead,
+			site:          &Site{UserURL: ts.URL},
+			expectedFound: true,
+		},
+		{
+			name:          "get",
+			method:        http.MethodGet,
+			site:          &Site{UserURL: ts.URL},
+			expectedFound: false,
+		},
+		{
+			name:           "head with error string",
+			method:         http.MethodHead,
+			site:           &Site{UserURL: ts.URL, ErrorString: "not found"},
+			expectedToFail: true,
+		},
+		{
+			name:           "unsupported method",
+			method:         http.MethodDelete,
+			site:           &Site{UserURL: ts.URL},
+			expectedToFail: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			results, err := Search(context.Background(), []*Site{tc.site}, Options{Method: tc.method})
+			if err != nil {
+				if !tc.expectedToFail {
+					t.Fatalf("not expected to fail: %v", err)
+				}
+				return
+			}
+
+			if tc.expectedToFail {
+				t.Fatalf("expected to fail")
+			}
+
+			if results[0].Found != tc.expectedFound {
+				t.Fatalf("expected found=%v. got=%v", tc.expectedFound, results[0].Found)
+			}
+		})
+	}
+}
+
+func TestSearchPostBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method != http.MethodPost || string(body) != `{"username": "me"}` || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	sites := []*Site{
+		{Name: "post", UserURL: ts.URL, Method: http.MethodPost, Body: `{"username": "me"}`},
+		{Name: "get", UserURL: ts.URL},
+	}
+
+	results, err := Search(context.Background(), sites, Options{})
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	expected := map[string]bool{"post": true, "get": false}
+	for _, r := range results {
+		if r.Found != expected[r.Name] {
+			t.Fatalf("expected site %q to have found=%v. got=%v", r.Name, expected[r.Name], r.Found)
+		}
+	}
+
+	sites = []*Site{{Name: "delete", UserURL: ts.URL, Method: http.MethodDelete}}
+	if _, err := Search(context.Background(), sites, Options{}); err == nil {
+		t.Fatalf("expected to fail with an unsupported site method")
+	}
+}
+
+func TestBodyContentType(t *testing.T) {
+	tt := []struct {
+		body     string
+		expected string
+	}{
+		{body: `{"username": "me"}`, expected: "application/json"},
+		{body: ` ["me"]`, expected: "application/json"},
+		{body: "username=me", expected: "application/x-www-form-urlencoded"},
+		{body: " ", expected: "application/x-www-form-urlencoded"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.body, func(t *testing.T) {
+			if ct := bodyContentType(tc.body); ct != tc.expected {
+				t.Fatalf("expected %q as content type. got=%q", tc.expected, ct)
+			}
+		})
+	}
+}
+
+func TestSearchFoundStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.String() {
+		case "/moved":
+			w.WriteHeader(http.StatusMovedPermanently)
+		case "/forbidden":
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer ts.Close()
+
+	sites := []*Site{
+		{Name: "ok", UserURL: ts.URL + "/ok"},
+		{Name: "moved", UserURL: ts.URL + "/moved"},
+		{Name: "forbidden", UserURL: ts.URL + "/forbidden"},
+		{Name: "override", UserURL: ts.URL + "/forbidden", FoundStatus: []int{http.StatusForbidden}},
+		{Name: "inverted", UserURL: ts.URL + "/forbidden", Invert: true},
+		{Name: "inverted ok", UserURL: ts.URL + "/ok", Invert: true},
+	}
+
+	c := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	opts := Options{Client: c, FoundStatus: []int{http.StatusOK, http.StatusMovedPermanently}}
+	results, err := Search(context.Background(), sites, opts)
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	expected := map[string]bool{"ok": true, "moved": true, "forbidden": false, "override": true, "inverted": true, "inverted ok": false}
+	for _, r := range results {
+		if r.Found != expected[r.Name] {
+			t.Fatalf("expected site %q to have found=%v. got=%v", r.Name, expected[r.Name], r.Found)
+		}
+	}
+}
+
+func TestSearchNotFoundSize(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.Write([]byte("user not found"))
+			return
+		}
+		w.Write([]byte("the profile of the user"))
+	}))
+	defer ts.Close()
+
+	size := &SizeRange{Min: 10, Max: 15}
+	sites := []*Site{
+		{Name: "missing", UserURL: ts.URL + "/missing", NotFoundSize: size},
+		{Name: "existing", UserURL: ts.URL + "/existing", NotFoundSize: size},
+		{Name: "without size", UserURL: ts.URL + "/missing"},
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		results, err := Search(context.Background(), sites, Options{Method: method})
+		if err != nil {
+			t.Fatalf("not expected to fail: %v", err)
+		}
+
+		expected := map[string]bool{"missing": false, "existing": true, "without size": true}
+		for _, r := range results {
+			if r.Found != expected[r.Name] {
+				t.Fatalf("expected site %q to have found=%v with method %s. got=%v", r.Name, expected[r.Name], method, r.Found)
+			}
+		}
+	}
+}
+
+func TestFoundByUser(t *testing.T) {
+	results := []*Result{
+		{Name: "github", Username: "me", Found: true},
+		{Name: "github", Username: "myself"},
+		{Name: "gitlab", Username: "me", Found: true},
+		{Name: "gitlab", Username: "myself", Error: "timeout"},
+		{Name: "twitter", Username: "you", Found: true},
+	}
+
+	byUser := FoundByUser(results)
+	expected := map[string][]*Result{
+		"me":  {results[0], results[2]},
+		"you": {results[4]},
+	}
+	if !reflect.DeepEqual(byUser, expected) {
+		t.Fatalf("expected %v. got=%v", expected, byUser)
+	}
+}
+
+func TestContainsErrors(t *testing.T) {
+	body := "sorry, this page is not available"
+	tt := []struct {
+		name     string
+		errs     []string
+		all      bool
+		expected bool
+	}{
+		{name: "without errors", errs: nil, expected: false},
+		{name: "without errors and all", errs: nil, all: true, expected: false},
+		{name: "any with one present", errs: []string{"not found", "not available"}, expected: true},
+		{name: "any with none present", errs: []string{"not found", "no such user"}, expected: false},
+		{name: "all present", errs: []string{"sorry", "not available"}, all: true, expected: true},
+		{name: "not all present", errs: []string{"sorry", "not found"}, all: true, expected: false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := containsErrors(body, tc.errs, tc.all); got != tc.expected {
+				t.Fatalf("expected %v with %q. got=%v", tc.expected, tc.errs, got)
+			}
+		})
+	}
+}
+
+func TestSearchErrorStrings(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("sorry, this page is not available"))
+	}))
+	defer ts.Close()
+
+	sites := []*Site{
+		{Name: "any", UserURL: ts.URL, ErrorStrings: []string{"not found", "not available"}},
+		{Name: "all", UserURL: ts.URL, ErrorStrings: []string{"not found", "not available"}, ErrorMatchAll: true},
+		{Name: "with error string", UserURL: ts.URL, ErrorString: "sorry", ErrorStrings: []string{"not available"}, ErrorMatchAll: true},
+	}
+
+	results, err := Search(context.Background(), sites, Options{})
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	expected := map[string]bool{"any": false, "all": true, "with error string": false}
+	for _, r := range results {
+		if r.Found != expected[r.Name] {
+			t.Fatalf("expected site %q to have found=%v. got=%v", r.Name, expected[r.Name], r.Found)
+		}
+	}
+
+	if _, err := Search(context.Background(), sites[:1], Options{Method: http.MethodHead}); err == nil {
+		t.Fatalf("expected to fail with method HEAD and error strings")
+	}
+}
+
+func TestSearchMaxBodyBytes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("a", 100) + "user not found"))
+	}))
+	defer ts.Close()
+
+	tt := []struct {
+		name     string
+		max      int64
+		expected bool
+	}{
+		{name: "without limit", max: 0, expected: false},
+		{name: "larger limit", max: 1000, expected: false},
+		{name: "truncated", max: 50, expected: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			sites := []*Site{{UserURL: ts.URL, ErrorString: "not found"}}
+			results, err := Search(context.Background(), sites, Options{MaxBodyBytes: tc.max})
+			if err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+
+			if results[0].Found != tc.expected {
+				t.Fatalf("expected found=%v. got=%v", tc.expected, results[0].Found)
+			}
+		})
+	}
+}
+
+func TestSearchMinSize(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.Write([]byte(" "))
+			return
+		}
+		w.Write([]byte("the profile of the user"))
+	}))
+	defer ts.Close()
+
+	sites := []*Site{
+		{Name: "missing", UserURL: ts.URL + "/missing", MinSize: 10},
+		{Name: "existing", UserURL: ts.URL + "/existing", MinSize: 10},
+		{Name: "too short", UserURL: ts.URL + "/existing", MinSize: 100},
+		{Name: "without min size", UserURL: ts.URL + "/missing"},
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		results, err := Search(context.Background(), sites, Options{Method: method})
+		if err != nil {
+			t.Fatalf("not expected to fail: %v", err)
+		}
+
+		expected := map[string]bool{"missing": false, "existing": true, "too short": false, "without min size": true}
+		for _, r := range results {
+			if r.Found != expected[r.Name] {
+				t.Fatalf("expected site %q to have found=%v with method %s. got=%v", r.Name, expected[r.Name], method, r.Found)
+			}
+		}
+	}
+}
+
+func TestSearchRequestTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+	}))
+	defer ts.Close()
+
+	sites := []*Site{
+		{Name: "slow", UserURL: ts.URL + "/slow"},
+		{Name: "fast", UserURL: ts.URL + "/fast"},
+		{Name: "slow with site timeout", UserURL: ts.URL + "/slow", Timeout: time.Second},
+	}
+
+	results, err := Search(context.Background(), sites, Options{
+		Client:         &http.Client{Timeout: time.Second},
+		Goroutines:     3,
+		RequestTimeout: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	expected := map[string]bool{"slow": false, "fast": true, "slow with site timeout": false}
+	for _, r := range results {
+		if r.Found != expected[r.Name] {
+			t.Fatalf("expected site %q to have found=%v. got=%v (%v)", r.Name, expected[r.Name], r.Found, r.Error)
+		}
+
+		if !r.Found && r.ErrorKind != "timeout" {
+			t.Fatalf("expected site %q to time out. got=%q (%v)", r.Name, r.ErrorKind, r.Error)
+		}
+	}
+}
+
+func TestSearchErrorKind(t *testing.T) {
+	sites := []*Site{{Name: "refused", UserURL: "http://127.0.0.1:1/me"}}
+	results, err := Search(context.Background(), sites, Options{})
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	if results[0].Error == "" || results[0].ErrorKind != "refused" {
+		t.Fatalf("expected the error to be classified as %q. got=%q (%v)", "refused", results[0].ErrorKind, results[0].Error)
+	}
+}
+
+func TestSearchNotFoundRedirect(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			http.Redirect(w, r, "/", http.StatusFound)
+		case "/moved":
+			http.Redirect(w, r, "/me", http.StatusMovedPermanently)
+		}
+	}))
+	defer ts.Close()
+
+	home, _ := url.Parse(ts.URL + "/")
+	sites := []*Site{
+		{Name: "missing", UserURL: ts.URL + "/missing", NotFoundRedirect: home},
+		{Name: "moved", UserURL: ts.URL + "/moved", NotFoundRedirect: home},
+		{Name: "no target", UserURL: ts.URL + "/missing"},
+	}
+
+	results, err := Search(context.Background(), sites, Options{})
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	expected := map[string]bool{"missing": false, "moved": true, "no target": true}
+	for _, r := range results {
+		if r.Found != expected[r.Name] {
+			t.Fatalf("expected site %q to have found=%v. got=%v", r.Name, expected[r.Name], r.Found)
+		}
+	}
+}
+
+func TestSearchSnippet(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("profile not found"))
+	}))
+	defer ts.Close()
+
+	tt := []struct {
+		name     string
+		site     *Site
+		snippet  int
+		expected string
+		found    bool
+	}{
+		{name: "without snippet", site: &Site{UserURL: ts.URL}, expected: "", found: true},
+		{name: "unread body", site: &Site{UserURL: ts.URL}, snippet: 7, expected: "profile", found: true},
+		{name: "read body", site: &Site{UserURL: ts.URL, ErrorString: "not found"}, snippet: 7, expected: "profile", found: false},
+		{name: "short body", site: &Site{UserURL: ts.URL}, snippet: 100, expected: "profile not found", found: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			results, err := Search(context.Background(), []*Site{tc.site}, Options{Snippet: tc.snippet})
+			if err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+
+			if results[0].Snippet != tc.expected {
+				t.Fatalf("expected snippet %q. got=%q", tc.expected, results[0].Snippet)
+			}
+
+			if results[0].Found != tc.found {
+				t.Fatalf("expected found=%v. got=%v", tc.found, results[0].Found)
+			}
+		})
+	}
+}
+
+func TestSearchCheckMainURL(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/me":
+		case "/api/me":
+			w.Write([]byte(`{"error": "not found"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	tt := []struct {
+		name     string
+		site     *Site
+		check    bool
+		expected bool
+	}{
+		{name: "disabled", site: &Site{MainURL: ts.URL + "/me", UserURL: ts.URL + "/api/me", ErrorString: "not found"}, expected: false},
+		{name: "found on mainURL", site: &Site{MainURL: ts.URL + "/me", UserURL: ts.URL + "/api/me", ErrorString: "not found"}, check: true, expected: true},
+		{name: "not found on both", site: &Site{MainURL: ts.URL + "/missing", UserURL: ts.URL + "/api/me", ErrorString: "not found"}, check: true, expected: false},
+		{name: "userURL error", site: &Site{MainURL: ts.URL + "/me", UserURL: "http://127.0.0.1:1/me"}, check: true, expected: true},
+		{name: "same URL", site: &Site{MainURL: ts.URL + "/missing", UserURL: ts.URL + "/missing"}, check: true, expected: false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			results, err := Search(context.Background(), []*Site{tc.site}, Options{CheckMainURL: tc.check})
+			if err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+
+			r := results[0]
+			if r.Found != tc.expected {
+				t.Fatalf("expected found=%v. got=%v", tc.expected, r.Found)
+			}
+
+			if r.Found && r.Error != "" {
+				t.Fatalf("expected a found result without error. got=%q", r.Error)
+			}
+		})
+	}
+}
+
+func TestSearchTraceRedirects(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/moved", http.StatusMovedPermanently)
+		case "/moved":
+			http.Redirect(w, r, "/me", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		}
+	}))
+	defer ts.Close()
+
+	stop := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	// Like the default policy of an http.Client, the
+	// loop is stopped at the 10th request.
+	loop := make([]string, 9)
+	for i := range loop {
+		loop[i] = ts.URL + "/loop"
+	}
+
+	tt := []struct {
+		name     string
+		client   *http.Client
+		path     string
+		trace    bool
+		expected []string
+	}{
+		{name: "without trace", client: &http.Client{}, path: "/old"},
+		{name: "chain", client: &http.Client{}, path: "/old", trace: true, expected: []string{ts.URL + "/moved", ts.URL + "/me"}},
+		{name: "without redirects", client: &http.Client{}, path: "/me", trace: true},
+		{name: "not followed", client: stop, path: "/old", trace: true},
+		{name: "loop", client: &http.Client{}, path: "/loop", trace: true, expected: loop},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			sites := []*Site{{UserURL: ts.URL + tc.path}}
+			results, err := Search(context.Background(), sites, Options{Client: tc.client, TraceRedirects: tc.trace})
+			if err != nil {
+				t.Fatalf("not expected to fail: %v", err)
+			}
+
+			if !reflect.DeepEqual(results[0].Redirects, tc.expected) {
+				t.Fatalf("expected redirects %v. got=%v", tc.expected, results[0].Redirects)
+			}
+		})
+	}
+}
+
+func TestSameURL(t *testing.T) {
+	target, _ := url.Parse("https://site.com/")
+	tt := []struct {
+		u        string
+		expected bool
+	}{
+		{u: "https://site.com", expected: true},
+		{u: "http://SITE.com/", expected: true},
+		{u: "https://site.com/me", expected: false},
+		{u: "https://www.site.com/", expected: false},
+		{u: "https://site.com/?lang=en", expected: false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.u, func(t *testing.T) {
+			u, _ := url.Parse(tc.u)
+			if got := sameURL(u, target); got != tc.expected {
+				t.Fatalf("expected %q to be the same as %q=%v. got=%v", tc.u, target, tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestSearchBlocked(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cloudflare":
+			w.Header().Set("Server", "cloudflare")
+			w.Header().Set("CF-Ray", "5f1a2b3c4d5e6f70-MAD")
+			w.WriteHeader(http.StatusForbidden)
+		case "/akamai":
+			w.Header().Set("Server", "AkamaiGHost")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/forbidden":
+			w.WriteHeader(http.StatusForbidden)
+		case "/cloudflare-ok":
+			w.Header().Set("Server", "cloudflare")
+		}
+	}))
+	defer ts.Close()
+
+	sites := []*Site{
+		{Name: "cloudflare", UserURL: ts.URL + "/cloudflare"},
+		{Name: "akamai", UserURL: ts.URL + "/akamai"},
+		{Name: "forbidden", UserURL: ts.URL + "/forbidden"},
+		{Name: "cloudflare ok", UserURL: ts.URL + "/cloudflare-ok"},
+		{Name: "inverted", UserURL: ts.URL + "/cloudflare", Invert: true},
+	}
+
+	results, err := Search(context.Background(), sites, Options{})
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	expected := map[string]bool{"cloudflare": true, "akamai": true, "forbidden": false, "cloudflare ok": false, "inverted": true}
+	for _, r := range results {
+		if r.Blocked != expected[r.Name] {
+			t.Fatalf("expected site %q to have blocked=%v. got=%v", r.Name, expected[r.Name], r.Blocked)
+		}
+
+		if r.Blocked && r.Found {
+			t.Fatalf("expected blocked site %q to not be found", r.Name)
+		}
+	}
+}
+
+func TestSearchAgents(t *testing.T) {
+	var mu sync.Mutex
+	agents := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		agents[r.UserAgent()]++
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	var sites []*Site
+	for i := 0; i < 6; i++ {
+		sites = append(sites, &Site{UserURL: ts.URL})
+	}
+
+	opts := Options{Agents: []string{"a", "b", "c"}, Goroutines: 3}
+	if _, err := Search(context.Background(), sites, opts); err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	for _, a := range opts.Agents {
+		if agents[a] != 2 {
+			t.Fatalf("expected agent %q to be used %v times. got=%v", a, 2, agents[a])
+		}
+	}
+}
+
+func TestSearchRate(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	var sites []*Site
+	for i := 0; i < 5; i++ {
+		sites = append(sites, &Site{UserURL: ts.URL})
+	}
+
+	start := time.Now()
+	if _, err := Search(context.Background(), sites, Options{Goroutines: 5, Rate: 50}); err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("expected Search to take at least %v. took=%v", 80*time.Millisecond, elapsed)
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	top := func(n int64) int64 { return n - 1 }
+	half := func(n int64) int64 { return n / 2 }
+	tt := []struct {
+		name     string
+		strategy string
+		max      time.Duration
+		rnd      func(int64) int64
+		first    int
+		expected []time.Duration
+	}{
+		{
+			name:     "fixed",
+			strategy: BackoffFixed,
+			expected: []time.Duration{100 * time.Millisecond, 100 * time.Millisecond, 100 * time.Millisecond, 100 * time.Millisecond},
+		},
+		{
+			name:     "fixed with max",
+			strategy: BackoffFixed,
+			max:      50 * time.Millisecond,
+			expected: []time.Duration{50 * time.Millisecond, 50 * time.Millisecond},
+		},
+		{
+			name:     "exponential",
+			strategy: BackoffExponential,
+			expected: []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond},
+		},
+		{
+			name:     "exponential with max",
+			strategy: BackoffExponential,
+			max:      300 * time.Millisecond,
+			expected: []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond},
+		},
+		{
+			name:     "full jitter at the top",
+			strategy: BackoffFullJitter,
+			max:      300 * time.Millisecond,
+			rnd:      top,
+			expected: []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond},
+		},
+		{
+			name:     "full jitter at the middle",
+			strategy: BackoffFullJitter,
+			rnd:      half,
+			expected: []time.Duration{50 * time.Millisecond, 100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond},
+		},
+		{
+			name:     "exponential overflows",
+			strategy: BackoffExponential,
+			first:    40,
+			expected: []time.Duration{math.MaxInt64, math.MaxInt64},
+		},
+		{
+			name:     "full jitter overflows",
+			strategy: BackoffFullJitter,
+			rnd:      top,
+			first:    40,
+			expected: []time.Duration{math.MaxInt64 - 1, math.MaxInt64 - 1},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			for i, expected := range tc.expected {
+				attempt := tc.first + i
+				wait := retryWait(tc.strategy, 100*time.Millisecond, tc.max, attempt, tc.rnd)
+				if wait != expected {
+					t.Fatalf("expected a wait of %v after attempt %v. got=%v", expected, attempt, wait)
+				}
+			}
+		})
+	}
+}
+
+func TestSearchInvalidBackoff(t *testing.T) {
+	sites := []*Site{{UserURL: "http://127.0.0.1:1/me"}}
+	if _, err := Search(context.Background(), sites, Options{Backoff: "linear"}); err == nil {
+		t.Fatalf("expected to fail with an unsupported backoff")
+	}
+}
+
+func TestRateInterval(t *testing.T) {
+	tt := []struct {
+		name     string
+		rate     float64
+		expected time.Duration
+	}{
+		{name: "one per second", rate: 1, expected: time.Second},
+		{name: "several per second", rate: 4, expected: 250 * time.Millisecond},
+		{name: "less than one per second", rate: 0.5, expected: 2 * time.Second},
+		{name: "faster than 1ns", rate: 2e9, expected: 1},
+		{name: "infinite", rate: math.Inf(1), expected: 1},
+		{name: "overflows", rate: 1e-11, expected: math.MaxInt64},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if d := rateInterval(tc.rate); d != tc.expected {
+				t.Fatalf("expected %v. got=%v", tc.expected, d)
+			}
+		})
+	}
+}
+
+func TestSearchExtremeRate(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	sites := []*Site{{UserURL: ts.URL}, {UserURL: ts.URL}}
+	results, err := Search(context.Background(), sites, Options{Rate: 2e9})
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	if len(results) != len(sites) {
+		t.Fatalf("expected %v results. got=%v", len(sites), len(results))
+	}
+}
+
+func TestRequestDelay(t *testing.T) {
+	tt := []struct {
+		name     string
+		delay    time.Duration
+		jitter   time.Duration
+		rnd      int64
+		expected time.Duration
+	}{
+		{
+			name: "no delay",
+		},
+		{
+			name:     "delay",
+			delay:    time.Second,
+			expected: time.Second,
+		},
+		{
+			name:     "min jitter",
+			delay:    time.Second,
+			jitter:   200 * time.Millisecond,
+			rnd:      0,
+			expected: 800 * time.Millisecond,
+		},
+		{
+			name:     "max jitter",
+			delay:    time.Second,
+			jitter:   200 * time.Millisecond,
+			rnd:      int64(400 * time.Millisecond),
+			expected: 1200 * time.Millisecond,
+		},
+		{
+			name:     "never negative",
+			jitter:   time.Second,
+			rnd:      0,
+			expected: 0,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rnd := func(n int64) int64 {
+				if tc.rnd >= n {
+					t.Fatalf("expected random number to be lower than %v. got=%v", n, tc.rnd)
+				}
+				return tc.rnd
+			}
+
+			if d := requestDelay(tc.delay, tc.jitter, rnd); d != tc.expected {
+				t.Fatalf("expected %v as delay. got=%v", tc.expected, d)
+			}
+		})
+	}
+}
+
+func TestSearchDelay(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	sites := []*Site{{UserURL: ts.URL}, {UserURL: ts.URL}, {UserURL: ts.URL}}
+
+	start := time.Now()
+	if _, err := Search(context.Background(), sites, Options{Delay: 30 * time.Millisecond, Jitter: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Fatalf("expected Search to take at least %v. took=%v", 60*time.Millisecond, elapsed)
+	}
+}
+
+func TestSearchCanceled(t *testing.T) {
+	block := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-block:
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+	defer close(block)
+
+	var sites []*Site
+	for i := 0; i < 100; i++ {
+		sites = append(sites, &Site{Name: "blocked", UserURL: ts.URL})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	results, err := Search(ctx, sites, Options{Goroutines: 2})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected %v as error. got=%v", context.DeadlineExceeded, err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected Search to return promptly. took=%v", elapsed)
+	}
+
+	if len(results) >= len(sites) {
+		t.Fatalf("expected less than %v results. got=%v", len(sites), len(results))
+	}
+}
+
+func TestSearchOnResult(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	var sites []*Site
+	for i := 0; i < 100; i++ {
+		sites = append(sites, &Site{Name: strconv.Itoa(i), UserURL: ts.URL})
+	}
+
+	// The map is not guarded on purpose: the calls
+	// to OnResult must not be made concurrently.
+	seen := map[string]int{}
+	results, err := Search(context.Background(), sites, Options{
+		Goroutines: 20,
+		OnResult: func(r *Result) {
+			seen[r.Name]++
+		},
+	})
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	if len(seen) != len(results) {
+		t.Fatalf("expected %v results passed to OnResult. got=%v", len(results), len(seen))
+	}
+
+	for name, n := range seen {
+		if n != 1 {
+			t.Fatalf("expected result %q to be passed once. got=%v", name, n)
+		}
+	}
+}
+
+func TestSearchHighConcurrency(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	var sites []*Site
+	for i := 0; i < 1000; i++ {
+		path := "/me"
+		if i%2 == 0 {
+			path = "/missing"
+		}
+		sites = append(sites, &Site{Name: "site", UserURL: ts.URL + path})
+	}
+
+	for _, deadline := range []time.Duration{0, 20 * time.Millisecond} {
+		ctx := context.Background()
+		if deadline > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, deadline)
+			defer cancel()
+		}
+
+		out := make(chan *Result)
+		var streamed int
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for range out {
+				streamed++
+			}
+		}()
+
+		results, _ := Search(ctx, sites, Options{Goroutines: 200, Results: out})
+		close(out)
+		<-done
+
+		if streamed != len(results) {
+			t.Fatalf("expected %v streamed results with deadline %v. got=%v", len(results), deadline, streamed)
+		}
+
+		if deadline == 0 && len(results) != len(sites) {
+			t.Fatalf("expected %v results. got=%v", len(sites), len(results))
+		}
+	}
+}
+
+// searchPerSite checks sites like Search did before using a pool
+// of workers: with one goroutine per site gated by a semaphore.
+// It is only kept to compare both approaches in BenchmarkSearch.
+func searchPerSite(ctx context.Context, sites []*Site, opts Options) []*Result {
+	out := make(chan *Result, opts.Goroutines)
+	sema := make(chan struct{}, opts.Goroutines)
+	var wg sync.WaitGroup
+
+	results := []*Result{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for r := range out {
+			results = append(results, r)
+		}
+	}()
+
+	for _, s := range sites {
+		sema <- struct{}{}
+		wg.Add(1)
+		go func(s *Site) {
+			defer func() {
+				<-sema
+				wg.Done()
+			}()
+			out <- check(ctx, s, opts.Client, "", &opts)
+		}(s)
+	}
+
+	wg.Wait()
+	close(out)
+	<-done
+
+	return results
+}
+
+func BenchmarkSearch(b *testing.B) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	var sites []*Site
+	for i := 0; i < 2000; i++ {
+		sites = append(sites, &Site{Name: "site", UserURL: ts.URL})
+	}
+
+	// Both approaches keep an idle connection for each goroutine
+	// so the benchmark does not measure the creation of new ones.
+	c := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: 20}}
+	opts := Options{Client: c, Method: http.MethodGet, FoundStatus: []int{http.StatusOK}, Goroutines: 20}
+
+	b.Run("pool", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := Search(context.Background(), sites, opts); err != nil {
+				b.Fatalf("not expected to fail: %v", err)
+			}
+		}
+	})
+
+	b.Run("per site", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			searchPerSite(context.Background(), sites, opts)
+		}
+	})
+}
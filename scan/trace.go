@@ -0,0 +1,122 @@
+package scan
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Trace holds the timings of a request made to a site, measured
+// with net/http/httptrace. If the request is redirected, DNS,
+// Connect and TLS add the ones of every hop.
+type Trace struct {
+	Name       string
+	User       string
+	URL        string
+	StatusCode int
+	// DNS is the time spent resolving the host. It is 0 if
+	// the host is an IP or the connection was reused.
+	DNS time.Duration
+	// Connect is the time spent opening the TCP connection.
+	Connect time.Duration
+	// TLS is the time spent on the TLS handshake.
+	TLS time.Duration
+	// FirstByte is the time since the request was started
+	// until the first byte of the response was received.
+	FirstByte time.Duration
+	// Total is the time since the request was started
+	// until the headers of the response were read.
+	Total time.Duration
+	// Reused reports whether the request was
+	// made on an already opened connection.
+	Reused bool
+	Err    error
+}
+
+// tracer measures the timings of a request. The hooks of
+// httptrace can be called from other goroutines, even after
+// the request is done, so its state is guarded by mu.
+type tracer struct {
+	mu        sync.Mutex
+	start     time.Time
+	dnsStart  time.Time
+	connStart map[string]time.Time
+	tlsStart  time.Time
+	t         Trace
+}
+
+func newTracer(start time.Time) *tracer {
+	return &tracer{start: start, connStart: map[string]time.Time{}}
+}
+
+// clientTrace returns the hooks that record the timings on tr.
+func (tr *tracer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			tr.mu.Lock()
+			tr.t.Reused = info.Reused
+			tr.mu.Unlock()
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			tr.mu.Lock()
+			tr.dnsStart = time.Now()
+			tr.mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			tr.mu.Lock()
+			tr.t.DNS += time.Since(tr.dnsStart)
+			tr.mu.Unlock()
+		},
+		// With several addresses, the connections can be
+		// opened in parallel, so they are told by address.
+		ConnectStart: func(network, addr string) {
+			tr.mu.Lock()
+			tr.connStart[network+addr] = time.Now()
+			tr.mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			tr.mu.Lock()
+			if err == nil {
+				tr.t.Connect += time.Since(tr.connStart[network+addr])
+			}
+			tr.mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			tr.mu.Lock()
+			tr.tlsStart = time.Now()
+			tr.mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			tr.mu.Lock()
+			tr.t.TLS += time.Since(tr.tlsStart)
+			tr.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			tr.mu.Lock()
+			tr.t.FirstByte = time.Since(tr.start)
+			tr.mu.Unlock()
+		},
+	}
+}
+
+// done returns the Trace of the request made to site,
+// which got resp or err after elapsed.
+func (tr *tracer) done(site *Site, resp *http.Response, elapsed time.Duration, err error) *Trace {
+	tr.mu.Lock()
+	t := tr.t
+	tr.mu.Unlock()
+
+	t.Name = site.Name
+	t.User = site.User
+	t.URL = site.UserURL
+	t.Total = elapsed
+	t.Err = err
+	if resp != nil {
+		t.StatusCode = resp.StatusCode
+		t.URL = resp.Request.URL.String()
+	}
+
+	return &t
+}
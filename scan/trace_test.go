@@ -0,0 +1,57 @@
+package scan
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestSearchOnTrace(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	sites := []*Site{
+		{Name: "found", User: "me", UserURL: ts.URL + "/me"},
+		{Name: "missing", User: "me", UserURL: ts.URL + "/missing"},
+	}
+
+	var mu sync.Mutex
+	traces := map[string]*Trace{}
+	_, err := Search(context.Background(), sites, Options{
+		Client:     ts.Client(),
+		Goroutines: 2,
+		OnTrace: func(tr *Trace) {
+			mu.Lock()
+			traces[tr.Name] = tr
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatalf("not expected to fail: %v", err)
+	}
+
+	if len(traces) != len(sites) {
+		t.Fatalf("expected %v traces. got=%v", len(sites), len(traces))
+	}
+
+	for name, expected := range map[string]int{"found": http.StatusOK, "missing": http.StatusNotFound} {
+		tr := traces[name]
+		if tr.StatusCode != expected || tr.Err != nil {
+			t.Fatalf("expected %s to be traced with status %v. got=%v and err=%v", name, expected, tr.StatusCode, tr.Err)
+		}
+
+		if !tr.Reused && (tr.Connect <= 0 || tr.TLS <= 0) {
+			t.Fatalf("expected %s to trace the connection. got connect=%v and tls=%v", name, tr.Connect, tr.TLS)
+		}
+
+		if tr.FirstByte <= 0 || tr.FirstByte > tr.Total {
+			t.Fatalf("expected %s first byte to be in (0,%v]. got=%v", name, tr.Total, tr.FirstByte)
+		}
+	}
+}